@@ -0,0 +1,113 @@
+package helper
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Writes a tar stream of the src path to the given writer.
+// If src is a directory, its contents are archived relative to src.
+// If src is a file, it is archived as a single member named after name.
+// Returns an error if any path cannot be read or written.
+func writeTar(writer io.Writer, src string, name string) error {
+	tarWriter := tar.NewWriter(writer)
+	root, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if !root.IsDir() {
+		err = writeTarMember(tarWriter, src, name, root)
+		if err != nil {
+			return err
+		}
+		return tarWriter.Close()
+	}
+	err = filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == src {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		relpath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		return writeTarMember(tarWriter, path, filepath.ToSlash(relpath), info)
+	})
+	if err != nil {
+		return err
+	}
+	return tarWriter.Close()
+}
+
+// Writes a single path to a tar stream.
+// Returns an error if the path cannot be read or written.
+func writeTarMember(tarWriter *tar.Writer, path string, name string, info fs.FileInfo) error {
+	link := ""
+	if info.Mode()&fs.ModeSymlink != 0 {
+		var err error
+		link, err = os.Readlink(path)
+		if err != nil {
+			return err
+		}
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	err = tarWriter.WriteHeader(header)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	handle, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	_, err = io.CopyBuffer(tarWriter, handle, make([]byte, 1024*1024))
+	return err
+}
+
+// Creates a zstd compressed tar archive (at dest) of the src path.
+// If src is a file, it is archived as a single member named 'path'.
+// Returns an error if the archive cannot be created.
+func createTarZstd(ctx context.Context, src string, dest string) error {
+	Logger(ctx).Info("create archive", "src", src, "dest", dest)
+	handle, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	encoder, err := zstd.NewWriter(handle)
+	if err != nil {
+		return err
+	}
+	err = writeTar(encoder, src, "path")
+	if err != nil {
+		encoder.Close()
+		return err
+	}
+	err = encoder.Close()
+	if err != nil {
+		return err
+	}
+	return handle.Close()
+}
@@ -0,0 +1,354 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// backupTimeFormat is the (UTC) timestamp format embedded within backup archive names - millisecond precision keeps the names of back-to-back backups (e.g., 'backup now' following a scheduled backup) distinct
+const backupTimeFormat = "20060102T150405.000Z"
+
+// backupsDir is the name of the entrypoint directory (see: [Dirs]) that holds backup archives
+const backupsDir = "backups"
+
+// BackupOpts defines the options used in conjunction with the [RunBackup] function.
+// Source names the entrypoint directory (see: [Dirs]) to back up (e.g., 'data') - archives are written to the 'backups' directory.  Backups are disabled when Source is unset.
+// Backups run every Interval (if set) and when the entrypoint shuts down (if OnShutdown is set - once the entrypoint's main callback returns, so that the server's final save is captured).
+// Container runtimes kill the entrypoint after their own stop timeout (e.g., docker's 'stop_grace_period', default: 10s) - which should be raised to cover the shutdown hook chain, the server's exit and the shutdown backup.
+// PreHook runs before a backup (e.g., to flush and pause world saves via rcon - see: [BackupRconHook]) - a failing PreHook aborts the backup.  PostHook runs after every backup whose PreHook succeeded.  Hooks are skipped by the shutdown backup (the server has exited).
+// Retention keeps the KeepLast most recent archives, the newest archive of each of the KeepDaily most recent days and the newest archive of each of the KeepWeekly most recent (ISO) weeks.  When all are unset, every archive is kept.
+type BackupOpts struct {
+	Interval   time.Duration `env:"BACKUP_INTERVAL" validate:"min=1m"`
+	KeepDaily  int           `env:"BACKUP_KEEP_DAILY" validate:"min=0"`
+	KeepLast   int           `env:"BACKUP_KEEP_LAST" validate:"min=0"`
+	KeepWeekly int           `env:"BACKUP_KEEP_WEEKLY" validate:"min=0"`
+	OnShutdown bool          `env:"BACKUP_ON_SHUTDOWN"`
+	PostHook   entrypointCb
+	PreHook    entrypointCb
+	Source     string `env:"BACKUP_SOURCE"`
+}
+
+// Validates the provided options against the entrypoint's directories.
+// Returns an error if the source directory or the 'backups' directory are unset.
+// Returns an error if the 'backups' directory is (or is within) the source directory - each backup would otherwise archive every prior backup.
+func (opts BackupOpts) validate(dirs Map[string, string]) error {
+	if opts.Source == "" {
+		return nil
+	}
+	src, ok := dirs[opts.Source]
+	if !ok {
+		return fmt.Errorf("backup source directory %s unset", opts.Source)
+	}
+	dir, ok := dirs[backupsDir]
+	if !ok {
+		return fmt.Errorf("backup directory %s unset", backupsDir)
+	}
+	rel, err := filepath.Rel(src, dir)
+	if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("backup directory %s (%s) within backup source %s (%s)", backupsDir, dir, opts.Source, src)
+	}
+	return nil
+}
+
+// backupArchive is a backup archive found within the backups directory
+type backupArchive struct {
+	path    string
+	created time.Time
+}
+
+// Lists the backup archives of a source within dir (newest first).
+// Files that do not follow the backup naming convention ('<source>-<timestamp>.tar.zst') are ignored.
+// Returns an error if dir cannot be read.
+func listBackups(dir string, source string) ([]backupArchive, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []backupArchive{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	archives := []backupArchive{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, source+"-") || !strings.HasSuffix(name, ".tar.zst") {
+			continue
+		}
+		timestamp := strings.TrimSuffix(strings.TrimPrefix(name, source+"-"), ".tar.zst")
+		created, err := time.Parse(backupTimeFormat, timestamp)
+		if err != nil {
+			continue
+		}
+		archives = append(archives, backupArchive{path: filepath.Join(dir, name), created: created})
+	}
+	slices.SortFunc(archives, func(a backupArchive, b backupArchive) int { return b.created.Compare(a.created) })
+	return archives, nil
+}
+
+// Selects the archives (ordered newest first) that fall outside the retention policy (see: [BackupOpts])
+func getExpiredBackups(archives []backupArchive, opts BackupOpts) []backupArchive {
+	if opts.KeepLast == 0 && opts.KeepDaily == 0 && opts.KeepWeekly == 0 {
+		return []backupArchive{}
+	}
+	keep := map[string]bool{}
+	for index := 0; index < len(archives) && index < opts.KeepLast; index++ {
+		keep[archives[index].path] = true
+	}
+	// keeps the newest archive of each of the most recent periods (as identified by the period callback)
+	keepPeriods := func(count int, period func(created time.Time) string) {
+		periods := []string{}
+		for _, archive := range archives {
+			current := period(archive.created)
+			if slices.Contains(periods, current) {
+				continue
+			}
+			if len(periods) >= count {
+				break
+			}
+			periods = append(periods, current)
+			keep[archive.path] = true
+		}
+	}
+	keepPeriods(opts.KeepDaily, func(created time.Time) string {
+		return created.Format(time.DateOnly)
+	})
+	keepPeriods(opts.KeepWeekly, func(created time.Time) string {
+		year, week := created.ISOWeek()
+		return fmt.Sprintf("%d-%d", year, week)
+	})
+	expired := []backupArchive{}
+	for _, archive := range archives {
+		if !keep[archive.path] {
+			expired = append(expired, archive)
+		}
+	}
+	return expired
+}
+
+// Removes archives that fall outside the retention policy.
+// Returns an error if the backups cannot be listed or removed.
+func pruneBackups(ctx context.Context, dir string, opts BackupOpts) error {
+	archives, err := listBackups(dir, opts.Source)
+	if err != nil {
+		return err
+	}
+	for _, archive := range getExpiredBackups(archives, opts) {
+		Logger(ctx).Info("remove expired backup", "path", archive.path, "created", archive.created.Format(time.RFC3339))
+		err = os.Remove(archive.path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Acquires an exclusive lock on the backups directory (via flock on its '.lock' file) - preventing concurrent backups across processes (e.g., 'backup now' run via 'docker exec' overlapping a scheduled backup).
+// The lock file is opened read-only (flock does not require write access) so that a lock file created by root can still be locked by non-root processes.
+// Returns a function that releases the lock.
+// Returns an error if the lock cannot be acquired.
+func lockBackups(ctx context.Context, dir string) (func(), error) {
+	err := CreateDirs(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, ".lock")
+	handle, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0666)
+	if err != nil {
+		return nil, err
+	}
+	Logger(ctx).Info("acquire backup lock", "path", path)
+	err = syscall.Flock(int(handle.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		handle.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(handle.Fd()), syscall.LOCK_UN)
+		handle.Close()
+	}, nil
+}
+
+// Creates a backup archive of the source directory (see: [BackupConfig]) within the 'backups' directory, then removes archives that fall outside the retention policy.
+// The archive ('<source>-<timestamp>.tar.zst') is written to a temporary file and renamed once complete - partial archives are never left behind, and existing archives are never overwritten.
+// Backups are serialized across processes by a lock within the 'backups' directory.
+// Returns the path of the created archive.
+// Returns an error if backups are disabled (i.e., no source is configured).
+// Returns an error if the pre-backup hook fails (the backup is aborted).
+// Returns an error if the archive cannot be created, the post-backup hook fails or expired archives cannot be removed.
+func RunBackup(ctx context.Context) (string, error) {
+	return runBackup(ctx, true)
+}
+
+// Creates a backup archive (see: [RunBackup]) - running the backup hooks if hooks is set.
+// Returns the path of the created archive.
+// Returns an error if the backup fails.
+func runBackup(ctx context.Context, hooks bool) (string, error) {
+	opts := BackupConfig(ctx)
+	if opts.Source == "" {
+		return "", fmt.Errorf("backup source unset")
+	}
+	err := opts.validate(Dirs(ctx))
+	if err != nil {
+		return "", err
+	}
+	if !hooks {
+		opts.PreHook = nil
+		opts.PostHook = nil
+	}
+
+	src := Dirs(ctx)[opts.Source]
+	dir := Dirs(ctx)[backupsDir]
+	unlock, err := lockBackups(ctx, dir)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	start := time.Now()
+	dest := filepath.Join(dir, fmt.Sprintf("%s-%s.tar.zst", opts.Source, start.UTC().Format(backupTimeFormat)))
+	fail := func(err error) (string, error) {
+		AddCounter(ctx, "gsh_backup_failures_total", "Number of failed backups", 1, nil)
+		return "", err
+	}
+	_, err = os.Lstat(dest)
+	if err == nil {
+		return fail(fmt.Errorf("backup archive %s exists", dest))
+	}
+
+	Logger(ctx).Info("backup", "src", src, "dest", dest)
+	if opts.PreHook != nil {
+		err = opts.PreHook(ctx)
+		if err != nil {
+			return fail(fmt.Errorf("pre-backup hook failed: %w", err))
+		}
+	}
+	err = createBackup(ctx, src, dest)
+	if opts.PostHook != nil {
+		hookErr := opts.PostHook(ctx)
+		if hookErr != nil {
+			err = errors.Join(err, fmt.Errorf("post-backup hook failed: %w", hookErr))
+		}
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	ObserveDuration(ctx, "gsh_backup_duration_seconds", "Time spent creating backups", time.Since(start), nil)
+	SetGauge(ctx, "gsh_backup_last_success_timestamp_seconds", "Time of the last successful backup", float64(time.Now().Unix()), nil)
+	err = pruneBackups(ctx, dir, opts)
+	if err != nil {
+		return dest, err
+	}
+	return dest, nil
+}
+
+// Archives src into dest - writing to a temporary file (within dest's directory) that is renamed once complete.
+// Returns an error if the archive cannot be created.
+func createBackup(ctx context.Context, src string, dest string) error {
+	err := CreateDirs(ctx, filepath.Dir(dest))
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(dest), fmt.Sprintf(".%s.tmp", filepath.Base(dest)))
+	defer os.Remove(tmp)
+	err = createTarZstd(ctx, src, tmp)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// Creates a backup hook that sends console commands to the rcon server in order (e.g., 'save-off', 'save-all flush' before a backup and 'save-on' after it).
+// Returns an error if any command fails.
+func BackupRconHook(commands ...string) entrypointCb {
+	return func(ctx context.Context) error {
+		for _, command := range commands {
+			_, err := RconExec(ctx, command)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Wraps the entrypoint's main callback - running a final backup (see: [RunBackup]) once the callback returns following a shutdown (see: [RunShutdown]).
+// The backup runs once the server has exited so that it captures the server's final save - backup hooks are skipped as the server is no longer running.
+// A failed backup is logged and does not alter the callback's result.
+func withShutdownBackup(callback entrypointCb) entrypointCb {
+	return func(ctx context.Context) error {
+		err := callback(ctx)
+		if !ShutdownConfig(ctx).ran() {
+			return err
+		}
+		Logger(ctx).Info("run shutdown backup")
+		_, backupErr := runBackup(ctx, false)
+		if backupErr != nil {
+			Logger(ctx).Warn("shutdown backup failed", "error", backupErr.Error())
+		}
+		return err
+	}
+}
+
+// backupSchedule runs backups at a fixed interval in the background
+type backupSchedule struct {
+	done chan bool
+	stop chan bool
+}
+
+// Starts running backups every interval in the background.  Failed backups are logged and retried at the next interval.
+func startBackupSchedule(ctx context.Context, interval time.Duration) *backupSchedule {
+	bs := &backupSchedule{done: make(chan bool), stop: make(chan bool)}
+	Logger(ctx).Info("start backup schedule", "interval", interval.String())
+	go func() {
+		defer close(bs.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				_, err := RunBackup(ctx)
+				if err != nil {
+					Logger(ctx).Warn("scheduled backup failed", "error", err.Error())
+				}
+			case <-bs.stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return bs
+}
+
+// Stops the backup schedule - waiting for an in-progress backup to complete
+func (bs *backupSchedule) close() {
+	close(bs.stop)
+	<-bs.done
+}
+
+// Returns a callback that runs a backup subcommand:
+//
+//	now - runs a backup immediately (see: [RunBackup]) and prints the path of the created archive
+func backupCommand(args ...string) entrypointCb {
+	return func(ctx context.Context) error {
+		if len(args) == 0 {
+			return fmt.Errorf("backup command unset")
+		}
+		switch args[0] {
+		case "now":
+			path, err := RunBackup(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Println(path)
+			return nil
+		}
+		return fmt.Errorf("unknown backup command %s", args[0])
+	}
+}
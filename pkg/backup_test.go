@@ -0,0 +1,250 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Creates a context with backups of a temporary 'data' directory enabled
+func newTestBackupContext(t *testing.T, opts BackupOpts) context.Context {
+	t.Helper()
+	root := t.TempDir()
+	opts.Source = "data"
+	ctx := newTestContext(t)
+	ctx = context.WithValue(ctx, ctxKeyDirs{}, Map[string, string]{"backups": filepath.Join(root, "backups"), "data": filepath.Join(root, "data")})
+	ctx = context.WithValue(ctx, ctxKeyBackupConfig{}, opts)
+	ctx = context.WithValue(ctx, ctxKeyShutdown{}, newShutdown(nil, 0))
+	err := os.MkdirAll(Dirs(ctx)["data"], 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ctx
+}
+
+func TestShutdownBackupAfterExit(t *testing.T) {
+	failHook := func(ctx context.Context) error {
+		return fmt.Errorf("server not running")
+	}
+	ctx := newTestBackupContext(t, BackupOpts{PreHook: failHook, PostHook: failHook})
+	save := filepath.Join(Dirs(ctx)["data"], "save")
+	// the server writes its final save while stopping
+	main := func(ctx context.Context) error {
+		RunShutdown(ctx)
+		return os.WriteFile(save, []byte("final"), 0644)
+	}
+
+	err := withShutdownBackup(main)(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archives, err := listBackups(Dirs(ctx)["backups"], "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archives) != 1 {
+		t.Fatalf("found %d backups (expected 1)", len(archives))
+	}
+	dest := t.TempDir()
+	err = Extract(ctx, archives[0].path, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dest, "save"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "final" {
+		t.Fatalf("backup holds %q (expected final save)", data)
+	}
+}
+
+func TestShutdownBackupSkippedWithoutShutdown(t *testing.T) {
+	ctx := newTestBackupContext(t, BackupOpts{})
+	err := withShutdownBackup(func(ctx context.Context) error { return nil })(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archives, err := listBackups(Dirs(ctx)["backups"], "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archives) != 0 {
+		t.Fatalf("found %d backups (expected none)", len(archives))
+	}
+}
+
+func TestRunBackupLocked(t *testing.T) {
+	ctx := newTestBackupContext(t, BackupOpts{})
+	// a separate lock acquisition stands in for a backup running within another process
+	unlock, err := lockBackups(ctx, Dirs(ctx)["backups"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backupErr := make(chan error, 1)
+	go func() {
+		_, err := RunBackup(ctx)
+		backupErr <- err
+	}()
+	select {
+	case err := <-backupErr:
+		unlock()
+		t.Fatalf("backup ran while locked (error: %v)", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case err := <-backupErr:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("backup did not run once unlocked")
+	}
+}
+
+func TestBackupOptsValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		dirs      Map[string, string]
+		expectErr string
+	}{
+		{name: "separate dirs", dirs: Map[string, string]{"backups": "/backups", "data": "/data"}},
+		{name: "sibling with shared prefix", dirs: Map[string, string]{"backups": "/data-backups", "data": "/data"}},
+		{name: "source within backups", dirs: Map[string, string]{"backups": "/srv", "data": "/srv/data"}},
+		{name: "backups within source", dirs: Map[string, string]{"backups": "/data/backups", "data": "/data"}, expectErr: "within backup source"},
+		{name: "backups nested within source", dirs: Map[string, string]{"backups": "/data/world/../backups/daily", "data": "/data/"}, expectErr: "within backup source"},
+		{name: "backups is source", dirs: Map[string, string]{"backups": "/data", "data": "/data"}, expectErr: "within backup source"},
+		{name: "source unset", dirs: Map[string, string]{"backups": "/backups"}, expectErr: "backup source directory data unset"},
+		{name: "backups unset", dirs: Map[string, string]{"data": "/data"}, expectErr: "backup directory backups unset"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := BackupOpts{Source: "data"}.validate(test.dirs)
+			if test.expectErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.expectErr) {
+				t.Fatalf("error %v (expected %q)", err, test.expectErr)
+			}
+		})
+	}
+}
+
+func TestListBackups(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"data-20240101T120000.000Z.tar.zst",
+		"data-20240102T120000.500Z.tar.zst",
+		"data-20240102T120000.250Z.tar.zst",
+		"data-invalid.tar.zst",
+		"data-20240103T120000.000Z.tar.gz",
+		".data-20240104T120000.000Z.tar.zst.tmp",
+		"other-20240105T120000.000Z.tar.zst",
+	}
+	for _, name := range names {
+		err := os.WriteFile(filepath.Join(dir, name), []byte{}, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := os.Mkdir(filepath.Join(dir, "data-20240106T120000.000Z.tar.zst"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archives, err := listBackups(dir, "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := []string{}
+	for _, archive := range archives {
+		actual = append(actual, filepath.Base(archive.path))
+	}
+	expected := []string{"data-20240102T120000.500Z.tar.zst", "data-20240102T120000.250Z.tar.zst", "data-20240101T120000.000Z.tar.zst"}
+	if !slices.Equal(actual, expected) {
+		t.Fatalf("listed %v (expected %v)", actual, expected)
+	}
+
+	archives, err = listBackups(filepath.Join(dir, "missing"), "data")
+	if err != nil || len(archives) != 0 {
+		t.Fatalf("listed %v (error %v) within missing directory", archives, err)
+	}
+}
+
+func TestGetExpiredBackups(t *testing.T) {
+	// a backup every 12 hours (newest first) from 2023-12-31 (a sunday) to 2024-01-21
+	newest := time.Date(2024, 1, 21, 12, 0, 0, 0, time.UTC)
+	archives := []backupArchive{}
+	for index := range 44 {
+		created := newest.Add(-time.Duration(index) * 12 * time.Hour)
+		archives = append(archives, backupArchive{path: created.Format(backupTimeFormat), created: created})
+	}
+	tests := []struct {
+		name     string
+		opts     BackupOpts
+		expected []string
+	}{
+		{name: "no retention keeps everything", opts: BackupOpts{}, expected: nil},
+		{name: "keep last", opts: BackupOpts{KeepLast: 3}, expected: []string{"20240121T120000.000Z", "20240121T000000.000Z", "20240120T120000.000Z"}},
+		{name: "keep daily", opts: BackupOpts{KeepDaily: 3}, expected: []string{"20240121T120000.000Z", "20240120T120000.000Z", "20240119T120000.000Z"}},
+		{name: "keep weekly", opts: BackupOpts{KeepWeekly: 3}, expected: []string{"20240121T120000.000Z", "20240114T120000.000Z", "20240107T120000.000Z"}},
+		{name: "keep weekly beyond history", opts: BackupOpts{KeepWeekly: 10}, expected: []string{"20240121T120000.000Z", "20240114T120000.000Z", "20240107T120000.000Z", "20231231T120000.000Z"}},
+		{name: "combined", opts: BackupOpts{KeepDaily: 2, KeepLast: 2, KeepWeekly: 2}, expected: []string{"20240121T120000.000Z", "20240121T000000.000Z", "20240120T120000.000Z", "20240114T120000.000Z"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expired := getExpiredBackups(archives, test.opts)
+			kept := []string{}
+			for _, archive := range archives {
+				if !slices.ContainsFunc(expired, func(item backupArchive) bool { return item.path == archive.path }) {
+					kept = append(kept, archive.path)
+				}
+			}
+			if test.expected == nil {
+				if len(expired) != 0 {
+					t.Fatalf("expired %d backups (expected none)", len(expired))
+				}
+				return
+			}
+			if !slices.Equal(kept, test.expected) {
+				t.Fatalf("kept %v (expected %v)", kept, test.expected)
+			}
+		})
+	}
+}
+
+func TestRunBackupRetention(t *testing.T) {
+	ctx := newTestBackupContext(t, BackupOpts{KeepLast: 2})
+	paths := []string{}
+	for range 3 {
+		// back-to-back backups (i.e., within the same second) must not overwrite each other
+		time.Sleep(5 * time.Millisecond)
+		path, err := RunBackup(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	archives, err := listBackups(Dirs(ctx)["backups"], "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := []string{}
+	for _, archive := range archives {
+		actual = append(actual, archive.path)
+	}
+	expected := []string{paths[2], paths[1]}
+	if !slices.Equal(actual, expected) {
+		t.Fatalf("kept %v (expected %v)", actual, expected)
+	}
+}
@@ -1,28 +1,231 @@
 package helper
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 )
 
 // cmdUntilCb is a callback that allows the caller to cancel the command once an external condition has been reached
 type cmdUntilCb func(complete func()) error
 
+// cmdLineCb is a callback invoked for each line of output produced by a command
+type cmdLineCb func(line string)
+
+// cmdLineLimit is the longest line emitted by a [cmdLineWriter] - longer lines (or output lacking newlines) are split into multiple lines
+const cmdLineLimit = 64 * 1024
+
+// cmdRingBuffer retains the most recent lines written to it (up to a limit)
+type cmdRingBuffer struct {
+	limit int
+	lines []string
+	lock  sync.Mutex
+	start int
+}
+
+// Adds a line to the ring buffer - evicting the oldest line if the buffer is full
+func (rb *cmdRingBuffer) add(line string) {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	if rb.limit <= 0 {
+		return
+	}
+	if len(rb.lines) < rb.limit {
+		rb.lines = append(rb.lines, line)
+		return
+	}
+	rb.lines[rb.start] = line
+	rb.start = (rb.start + 1) % rb.limit
+}
+
+// Returns the retained lines (oldest first) joined by newlines
+func (rb *cmdRingBuffer) String() string {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	lines := append(slices.Clone(rb.lines[rb.start:]), rb.lines[:rb.start]...)
+	return strings.Join(lines, "\n")
+}
+
+// cmdLineWriter splits a command's output stream into lines - teeing raw output to the console and each line to the logger, a callback and a ring buffer.
+type cmdLineWriter struct {
+	callback cmdLineCb
+	console  io.Writer
+	ctx      context.Context
+	lock     sync.Mutex
+	log      bool
+	partial  []byte
+	retained *cmdRingBuffer
+	stream   string
+}
+
+// Emits a single line of output
+func (lw *cmdLineWriter) emit(line string) {
+	line = strings.TrimSuffix(line, "\r")
+	lw.retained.add(line)
+	if lw.log {
+		Logger(lw.ctx).Info("command output", "stream", lw.stream, "line", line)
+	}
+	if lw.callback != nil {
+		lw.callback(line)
+	}
+}
+
+// Emits any buffered partial line (i.e., output lacking a trailing newline)
+func (lw *cmdLineWriter) flush() {
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+	if len(lw.partial) == 0 {
+		return
+	}
+	lw.emit(string(lw.partial))
+	lw.partial = nil
+}
+
+// Writes output to the console (if attached) and emits each completed line.
+// Lines are capped at [cmdLineLimit] bytes - whether they arrive within a single write or across several.
+func (lw *cmdLineWriter) Write(data []byte) (int, error) {
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+	if lw.console != nil {
+		lw.console.Write(data)
+	}
+	remaining := data
+	for len(remaining) > 0 {
+		complete := false
+		index := bytes.IndexByte(remaining, '\n')
+		if index == -1 {
+			lw.partial = append(lw.partial, remaining...)
+			remaining = nil
+		} else {
+			lw.partial = append(lw.partial, remaining[:index]...)
+			remaining = remaining[index+1:]
+			complete = true
+		}
+		for len(lw.partial) > cmdLineLimit {
+			lw.emit(string(lw.partial[:cmdLineLimit]))
+			lw.partial = lw.partial[cmdLineLimit:]
+		}
+		if complete || len(lw.partial) == cmdLineLimit {
+			lw.emit(string(lw.partial))
+			lw.partial = nil
+		}
+	}
+	return len(data), nil
+}
+
+// cmdStdinForwarder forwards the process' stdin to the stdin pipe of the attached command.
+// A single goroutine reads stdin for the lifetime of the process (reads from stdin cannot be interrupted) - input received while no command is attached is discarded.
+type cmdStdinForwarder struct {
+	lock   sync.Mutex
+	once   sync.Once
+	writer io.Writer
+}
+
+// cmdStdin forwards the process' stdin to attached commands
+var cmdStdin = &cmdStdinForwarder{}
+
+// Forwards stdin to the provided writer until the returned callback is called
+func (sf *cmdStdinForwarder) attach(writer io.Writer) func() {
+	sf.once.Do(func() {
+		go sf.forward()
+	})
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+	sf.writer = writer
+	return func() {
+		sf.lock.Lock()
+		defer sf.lock.Unlock()
+		if sf.writer == writer {
+			sf.writer = nil
+		}
+	}
+}
+
+// Reads stdin until it is closed - writing its contents to the attached writer (if any)
+func (sf *cmdStdinForwarder) forward() {
+	buffer := make([]byte, 4096)
+	for {
+		count, err := os.Stdin.Read(buffer)
+		if count > 0 {
+			sf.lock.Lock()
+			if sf.writer != nil {
+				sf.writer.Write(buffer[:count])
+			}
+			sf.lock.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
 // a command is an internal extension of [exec.Cmd]
 type command struct {
+	attach        bool
 	ctx           context.Context
 	ctxCancel     func()
+	err           error
 	execCmd       *exec.Cmd
+	exited        chan bool
 	ignoreSignals bool
 	interval      time.Duration
+	stdin         io.WriteCloser
+	stop          CmdStopOpts
 	timeout       time.Duration
+	track         bool
 	until         cmdUntilCb
 }
 
+// Stops the running command in response to a termination signal.
+// Runs the entrypoint's shutdown hook chain (see: [RunShutdown]) and then stops the command - either by sending a console command (via rcon or stdin) or by forwarding the signal.
+// The command is killed if it fails to exit within the grace period (see: [CmdStopOpts]).
+func (cmd *command) shutdown(sig os.Signal) {
+	if cmd.execCmd.Process == nil {
+		return
+	}
+
+	if cmd.track {
+		SetServerState(cmd.ctx, ServerStateStopping)
+	}
+	RunShutdown(cmd.ctx)
+
+	var err error
+	if cmd.stop.Rcon != "" {
+		Logger(cmd.ctx).Info("stop command via rcon", "command", cmd.stop.Rcon)
+		_, err = RconExec(cmd.ctx, cmd.stop.Rcon)
+	} else if cmd.stop.Stdin != "" {
+		Logger(cmd.ctx).Info("stop command via stdin", "command", cmd.stop.Stdin)
+		_, err = io.WriteString(cmd.stdin, cmd.stop.Stdin+"\n")
+	} else {
+		err = cmd.execCmd.Process.Signal(sig)
+	}
+	if err != nil {
+		Logger(cmd.ctx).Warn("stop command failed - forwarding signal", "error", err.Error())
+		cmd.execCmd.Process.Signal(sig)
+	}
+
+	gracePeriod := cmd.stop.GracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = ShutdownConfig(cmd.ctx).gracePeriod
+	}
+	if gracePeriod <= 0 {
+		return
+	}
+	select {
+	case <-cmd.exited:
+	case <-time.After(gracePeriod):
+		Logger(cmd.ctx).Warn("grace period exceeded - killing command", "command", cmd.execCmd.Args, "gracePeriod", gracePeriod.String())
+		cmd.execCmd.Process.Kill()
+	}
+}
+
 // Truncates a string (replacing the excess with leading ellipses)
 func cmdTruncateString(data string, limit int) string {
 	if len(data) < limit {
@@ -32,33 +235,64 @@ func cmdTruncateString(data string, limit int) string {
 	return fmt.Sprintf("...%s", data[offset:])
 }
 
+// Returns the output captured by a command's stdout/stderr writer (if any)
+func cmdOutput(writer io.Writer) string {
+	switch writer := writer.(type) {
+	case *strings.Builder:
+		return writer.String()
+	case *cmdLineWriter:
+		writer.flush()
+		return writer.retained.String()
+	default:
+		return ""
+	}
+}
+
 // Runs the assembled command.
+// Returns the command's stdout - when streaming output line-by-line, only the most recent lines of stdout are returned (see: [CmdOpts]).
+// Returns an error if the command could not be assembled (e.g., its stdin pipe could not be created).
 // Returns an error if the command exits with a non-zero exit code.
 func (cmd *command) Run() (string, error) {
 	Logger(cmd.ctx).Info("run command", "command", cmd.execCmd.Args)
 
 	start := time.Now()
 	defer cmd.ctxCancel()
+	if cmd.err != nil {
+		return "", cmd.err
+	}
+
+	if cmd.track {
+		ReadinessTracker(cmd.ctx).start(cmd.ctx)
+		defer SetServerState(cmd.ctx, ServerStateStopped)
+	}
 
 	cmdFinished := make(chan bool, 1)
 	var cmdErr error
 	stdout := ""
 	stderr := ""
 	go func() {
+		defer close(cmd.exited)
 		if !cmd.ignoreSignals {
-			HandleSignal(cmd.ctx, func(sig os.Signal) {
-				cmd.execCmd.Process.Signal(sig)
-			})
+			unregister := HandleSignal(cmd.ctx, cmd.shutdown)
+			defer unregister()
 		}
-		cmdErr = cmd.execCmd.Run()
-		stdoutBuf, ok := cmd.execCmd.Stdout.(*strings.Builder)
-		if ok {
-			stdout = stdoutBuf.String()
+		if cmd.stdin != nil {
+			defer cmd.stdin.Close()
+			if cmd.attach {
+				detach := cmdStdin.attach(cmd.stdin)
+				defer detach()
+			}
 		}
-		stderrBuf, ok := cmd.execCmd.Stderr.(*strings.Builder)
-		if ok {
-			stderr = stderrBuf.String()
+		cmdErr = cmd.execCmd.Start()
+		if cmdErr == nil {
+			if cmd.track {
+				Metrics(cmd.ctx).setServerPid(cmd.execCmd.Process.Pid)
+				defer Metrics(cmd.ctx).setServerPid(0)
+			}
+			cmdErr = cmd.execCmd.Wait()
 		}
+		stdout = cmdOutput(cmd.execCmd.Stdout)
+		stderr = cmdOutput(cmd.execCmd.Stderr)
 		cmdFinished <- true
 	}()
 
@@ -121,16 +355,51 @@ func (cmd *command) Run() (string, error) {
 	return stdout, err
 }
 
-// CmdOpts defines the options used in conjunction with the [Command] function
+// CmdStopOpts defines how a command is stopped once a termination signal is received.
+// By default, the signal is forwarded to the command.
+// If Rcon is set, the console command is sent via rcon (see: [RconExec]) instead.
+// If Stdin is set, the console command is written to the command's stdin instead.
+// GracePeriod overrides the entrypoint's shutdown grace period (default: 8s) - a negative grace period disables killing the command.
+type CmdStopOpts struct {
+	GracePeriod time.Duration
+	Rcon        string
+	Stdin       string
+}
+
+// CmdOpts defines the options used in conjunction with the [Command] function.
+// Setting TrackReadiness marks the command as the game server - its lifecycle and output drive the entrypoint's readiness checks (see: [ReadinessCheck]).
+// Setting LogOutput, OnStderrLine, OnStdoutLine or TrackReadiness streams the command's output line-by-line - teeing it to the console (if attached), to the logger (if LogOutput is set) and to the line callbacks.
+// When streaming, only the most recent OutputRetention lines (default: 100) of each stream are retained for the command's result and error report - a negative OutputRetention is rejected when the command is run.
 type CmdOpts struct {
-	Attach        bool
-	Cwd           string
-	Env           []string
-	IgnoreSignals bool
-	Interval      time.Duration
-	Until         cmdUntilCb
-	User          User
-	Timeout       time.Duration
+	Attach          bool
+	Cwd             string
+	Env             []string
+	IgnoreSignals   bool
+	Interval        time.Duration
+	LogOutput       bool
+	OnStderrLine    cmdLineCb
+	OnStdoutLine    cmdLineCb
+	OutputRetention int
+	Stop            CmdStopOpts
+	TrackReadiness  bool
+	Until           cmdUntilCb
+	User            User
+	Timeout         time.Duration
+}
+
+// Returns true if the command's output should be streamed line-by-line
+func (opts CmdOpts) streaming() bool {
+	return opts.LogOutput || opts.OnStderrLine != nil || opts.OnStdoutLine != nil || opts.TrackReadiness
+}
+
+// Wraps a line callback such that lines are also observed by the readiness tracker
+func cmdReadinessLineCb(ctx context.Context, callback cmdLineCb) cmdLineCb {
+	return func(line string) {
+		ReadinessTracker(ctx).observe(ctx, line)
+		if callback != nil {
+			callback(line)
+		}
+	}
 }
 
 // Assembles a command object
@@ -156,20 +425,53 @@ func Command(ctx context.Context, cmdSlice []string, opts CmdOpts) *command {
 		execCmd.Stdin = os.Stdin
 		execCmd.Stdout = os.Stdout
 	}
+	if opts.TrackReadiness {
+		opts.OnStderrLine = cmdReadinessLineCb(ctx, opts.OnStderrLine)
+		opts.OnStdoutLine = cmdReadinessLineCb(ctx, opts.OnStdoutLine)
+	}
+	var err error
+	if opts.OutputRetention < 0 {
+		err = fmt.Errorf("command output retention %d negative", opts.OutputRetention)
+	}
+	if opts.streaming() {
+		retention := opts.OutputRetention
+		if retention <= 0 {
+			retention = 100
+		}
+		stderrWriter := &cmdLineWriter{callback: opts.OnStderrLine, ctx: ctx, log: opts.LogOutput, retained: &cmdRingBuffer{limit: retention}, stream: "stderr"}
+		stdoutWriter := &cmdLineWriter{callback: opts.OnStdoutLine, ctx: ctx, log: opts.LogOutput, retained: &cmdRingBuffer{limit: retention}, stream: "stdout"}
+		if opts.Attach {
+			stderrWriter.console = os.Stderr
+			stdoutWriter.console = os.Stdout
+		}
+		execCmd.Stderr = stderrWriter
+		execCmd.Stdout = stdoutWriter
+	}
 	if opts.Cwd != "" {
 		execCmd.Dir = opts.Cwd
 	}
 	if opts.Env != nil {
 		execCmd.Env = opts.Env
 	}
+	var stdin io.WriteCloser
+	if opts.Stop.Stdin != "" && err == nil {
+		execCmd.Stdin = nil
+		stdin, err = execCmd.StdinPipe()
+	}
 
 	return &command{
+		attach:        opts.Attach,
 		ctx:           ctx,
 		ctxCancel:     ctxCancel,
+		err:           err,
 		execCmd:       execCmd,
+		exited:        make(chan bool),
 		ignoreSignals: opts.IgnoreSignals,
 		interval:      opts.Interval,
+		stdin:         stdin,
+		stop:          opts.Stop,
 		timeout:       opts.Timeout,
+		track:         opts.TrackReadiness,
 		until:         opts.Until,
 	}
 }
@@ -0,0 +1,103 @@
+package helper
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCmdRingBuffer(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		lines    []string
+		expected string
+	}{
+		{name: "empty", limit: 3, lines: []string{}, expected: ""},
+		{name: "under limit", limit: 3, lines: []string{"a", "b"}, expected: "a\nb"},
+		{name: "at limit", limit: 3, lines: []string{"a", "b", "c"}, expected: "a\nb\nc"},
+		{name: "evicts oldest", limit: 3, lines: []string{"a", "b", "c", "d", "e"}, expected: "c\nd\ne"},
+		{name: "wraps repeatedly", limit: 2, lines: []string{"a", "b", "c", "d", "e", "f", "g"}, expected: "f\ng"},
+		{name: "disabled", limit: 0, lines: []string{"a", "b"}, expected: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buffer := &cmdRingBuffer{limit: test.limit}
+			for _, line := range test.lines {
+				buffer.add(line)
+			}
+			if buffer.String() != test.expected {
+				t.Fatalf("retained %q (expected %q)", buffer.String(), test.expected)
+			}
+		})
+	}
+}
+
+func TestCmdLineWriter(t *testing.T) {
+	long := strings.Repeat("a", cmdLineLimit)
+	tests := []struct {
+		name     string
+		writes   []string
+		expected []string
+	}{
+		{name: "single line", writes: []string{"hello\n"}, expected: []string{"hello"}},
+		{name: "multiple lines", writes: []string{"a\nb\nc\n"}, expected: []string{"a", "b", "c"}},
+		{name: "split across writes", writes: []string{"hel", "lo\nwor", "ld\n"}, expected: []string{"hello", "world"}},
+		{name: "carriage returns", writes: []string{"a\r\nb\r", "\n"}, expected: []string{"a", "b"}},
+		{name: "empty lines", writes: []string{"\n\na\n"}, expected: []string{"", "", "a"}},
+		{name: "partial line flushed", writes: []string{"a\nb"}, expected: []string{"a", "b"}},
+		{name: "line at limit", writes: []string{long + "\nb\n"}, expected: []string{long, "b"}},
+		{name: "long line in single write", writes: []string{long + "bc\nd\n"}, expected: []string{long, "bc", "d"}},
+		{name: "long line across writes", writes: []string{long[:10], long[10:] + "bc", "\nd\n"}, expected: []string{long, "bc", "d"}},
+		{name: "long output without newlines", writes: []string{long + long + "b"}, expected: []string{long, long, "b"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := []string{}
+			writer := &cmdLineWriter{callback: func(line string) { lines = append(lines, line) }, ctx: newTestContext(t), retained: &cmdRingBuffer{limit: 100}, stream: "stdout"}
+			for _, data := range test.writes {
+				count, err := writer.Write([]byte(data))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if count != len(data) {
+					t.Fatalf("wrote %d (expected %d)", count, len(data))
+				}
+			}
+			writer.flush()
+			if !slices.Equal(lines, test.expected) {
+				t.Fatalf("lines %d %q (expected %d)", len(lines), lines, len(test.expected))
+			}
+			if writer.retained.String() != strings.Join(test.expected, "\n") {
+				t.Fatalf("retained output does not match emitted lines")
+			}
+		})
+	}
+}
+
+func TestCommandStreaming(t *testing.T) {
+	ctx := newTestContext(t)
+	lock := sync.Mutex{}
+	stdout := []string{}
+	stderr := []string{}
+	opts := CmdOpts{
+		OnStderrLine:    func(line string) { lock.Lock(); defer lock.Unlock(); stderr = append(stderr, line) },
+		OnStdoutLine:    func(line string) { lock.Lock(); defer lock.Unlock(); stdout = append(stdout, line) },
+		OutputRetention: 2,
+	}
+	output, err := Command(ctx, []string{"sh", "-c", "printf 'a\\nb\\n'; printf 'e\\n' >&2; printf 'c\\nd'"}, opts).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(stdout, []string{"a", "b", "c", "d"}) {
+		t.Fatalf("stdout lines %q", stdout)
+	}
+	if !slices.Equal(stderr, []string{"e"}) {
+		t.Fatalf("stderr lines %q", stderr)
+	}
+	// only the most recent lines are retained
+	if output != "c\nd" {
+		t.Fatalf("output %q", output)
+	}
+}
@@ -0,0 +1,336 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Converts a config file name (see: [ConfigFiles]) into the form used within environment variable names (e.g., 'server-settings' -> 'SERVER_SETTINGS')
+func getConfigEnvName(name string) string {
+	return strings.Map(func(char rune) rune {
+		if char > unicode.MaxASCII || (!unicode.IsLetter(char) && !unicode.IsDigit(char)) {
+			return '_'
+		}
+		return unicode.ToUpper(char)
+	}, name)
+}
+
+// Applies patches defined by environment variables to the entrypoint's config files (see: [ConfigFiles]).
+// A config file named 'settings' is patched by the 'CONFIG_PATCH_SETTINGS' environment variable, which holds either an RFC6902 JSON patch or an RFC7386 merge patch (see: [PatchFile]).
+// Should be called once the config files have been written (e.g., after rendering templates).
+// Returns an error if a patched config file does not exist.
+// Returns an error if any patch fails.
+func ApplyConfigPatches(ctx context.Context) error {
+	names := ConfigFiles(ctx).Keys()
+	slices.Sort(names)
+	for _, name := range names {
+		variable := fmt.Sprintf("CONFIG_PATCH_%s", getConfigEnvName(name))
+		patch, ok := os.LookupEnv(variable)
+		if !ok || strings.TrimSpace(patch) == "" {
+			continue
+		}
+		Logger(ctx).Info("apply config patch", "name", name, "variable", variable)
+		err := PatchFile(ctx, ConfigFiles(ctx)[name], []byte(patch))
+		if err != nil {
+			return fmt.Errorf("%s: %w", variable, err)
+		}
+	}
+	return nil
+}
+
+// configOverlayPrefix is the prefix of environment variables that override config file keys (e.g., 'GSH_CFG__settings.ini__ServerSettings__MaxPlayers=20')
+const configOverlayPrefix = "GSH_CFG__"
+
+// configOverlay is a config file key override parsed from an environment variable (see: [ApplyConfigOverlays])
+type configOverlay struct {
+	err      error
+	file     string
+	keys     []string
+	path     string
+	value    string
+	variable string
+}
+
+// Finds a config file (see: [ConfigFiles]) by name - falling back to the base name of the config file's path (e.g., 'settings.ini')
+func getConfigFile(ctx context.Context, name string) (string, string, bool) {
+	configFiles := ConfigFiles(ctx)
+	path, ok := configFiles[name]
+	if ok {
+		return name, path, true
+	}
+	names := configFiles.Keys()
+	slices.Sort(names)
+	for _, candidate := range names {
+		if filepath.Base(configFiles[candidate]) == name {
+			return candidate, configFiles[candidate], true
+		}
+	}
+	return "", "", false
+}
+
+// Returns true if a config overlay is permitted by the allowlist (see: [ConfigOverlayAllowlist]).
+// Allowlist entries follow the overlay naming convention (e.g., 'settings.ini__ServerSettings__*') and each segment is matched (case-insensitively) as a glob (see: [path.Match]).
+// A nil allowlist permits every overlay.
+func isConfigOverlayAllowed(allowlist []string, file string, keys []string) bool {
+	if allowlist == nil {
+		return true
+	}
+	segments := append([]string{file}, keys...)
+	for _, entry := range allowlist {
+		patterns := strings.Split(entry, "__")
+		if len(patterns) != len(segments) {
+			continue
+		}
+		matched := true
+		for index, pattern := range patterns {
+			ok, err := path.Match(strings.ToLower(pattern), strings.ToLower(segments[index]))
+			if err != nil || !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses config overlays from the environment (sorted by variable name).
+// Overlays that reference unknown config files, are malformed or are disallowed (see: [ConfigOverlayAllowlist]) hold an error.
+func getConfigOverlays(ctx context.Context) []configOverlay {
+	overlays := []configOverlay{}
+	for _, item := range os.Environ() {
+		variable, value, _ := strings.Cut(item, "=")
+		if !strings.HasPrefix(variable, configOverlayPrefix) {
+			continue
+		}
+		overlay := configOverlay{value: value, variable: variable}
+		segments := strings.Split(strings.TrimPrefix(variable, configOverlayPrefix), "__")
+		file, path, ok := getConfigFile(ctx, segments[0])
+		switch {
+		case len(segments) < 2 || slices.Contains(segments, ""):
+			overlay.err = fmt.Errorf("malformed variable (expected %s<file>__<key>[__<key>...])", configOverlayPrefix)
+		case !ok:
+			overlay.err = fmt.Errorf("unknown config file %s", segments[0])
+		case !isConfigOverlayAllowed(ConfigOverlayAllowlist(ctx), file, segments[1:]):
+			overlay.err = fmt.Errorf("key not overridable")
+		}
+		if overlay.err == nil {
+			overlay.file = file
+			overlay.keys = segments[1:]
+			overlay.path = path
+		}
+		overlays = append(overlays, overlay)
+	}
+	slices.SortFunc(overlays, func(a configOverlay, b configOverlay) int { return strings.Compare(a.variable, b.variable) })
+	return overlays
+}
+
+// Logs a report of the config overlays found within the environment - values are omitted as they may hold secrets
+func reportConfigOverlays(ctx context.Context) {
+	overlays := getConfigOverlays(ctx)
+	if len(overlays) == 0 {
+		return
+	}
+	rejected := 0
+	for _, overlay := range overlays {
+		if overlay.err != nil {
+			rejected++
+			Logger(ctx).Warn("config overlay rejected", "variable", overlay.variable, "error", overlay.err.Error())
+			continue
+		}
+		Logger(ctx).Info("config overlay", "variable", overlay.variable, "file", overlay.file, "key", strings.Join(overlay.keys, "."))
+	}
+	Logger(ctx).Info("config overlays", "accepted", len(overlays)-rejected, "rejected", rejected)
+}
+
+// Coerces an overlay value into the type of the key's existing value.
+// Existing numbers are expected as [json.Number] values - integer-valued keys only accept integers.
+// When the key does not exist, booleans and numbers are inferred (and JSON arrays and objects are decoded) - other values remain strings.
+// Returns an error if the value cannot be coerced into the existing value's type.
+func coerceConfigValue(value string, existing any) (any, error) {
+	trimmed := strings.TrimSpace(value)
+	switch existing := existing.(type) {
+	case nil:
+		if strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+			var decoded any
+			if unmarshalJsonNumbers([]byte(trimmed), &decoded) == nil {
+				return decoded, nil
+			}
+		}
+		if parsed, err := strconv.ParseBool(trimmed); err == nil && strings.EqualFold(trimmed, strconv.FormatBool(parsed)) {
+			return parsed, nil
+		}
+		if parsed, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
+			return parsed, nil
+		}
+		if parsed, err := strconv.ParseFloat(trimmed, 64); err == nil {
+			return parsed, nil
+		}
+		return value, nil
+	case bool:
+		return strconv.ParseBool(strings.ToLower(trimmed))
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return strconv.ParseInt(trimmed, 10, 64)
+	case float32, float64:
+		return strconv.ParseFloat(trimmed, 64)
+	case json.Number:
+		_, err := strconv.ParseInt(existing.String(), 10, 64)
+		if err == nil {
+			return strconv.ParseInt(trimmed, 10, 64)
+		}
+		return strconv.ParseFloat(trimmed, 64)
+	case map[string]any, []any:
+		var decoded any
+		err := unmarshalJsonNumbers([]byte(trimmed), &decoded)
+		return decoded, err
+	}
+	return value, nil
+}
+
+// Applies config overlays to a single config file (via an RFC7386 merge patch - see: [PatchFile]).
+// Keys are matched case-insensitively against existing keys (retaining the existing key's case).
+// Returns an error if the config file cannot be read or patched.
+// Returns an error if overlays conflict (i.e., address the same key, or a key and one of its nested keys).
+// Returns an error if a value cannot be coerced into the existing value's type.
+func applyConfigOverlays(ctx context.Context, path string, overlays []configOverlay) error {
+	format, err := detectFileFormat(path)
+	if err != nil {
+		return err
+	}
+	codec, err := getFileFormat(format)
+	if err != nil {
+		return err
+	}
+	existing, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	document := map[string]any{}
+	err = codec.Unmarshal(existing, &document)
+	if err != nil {
+		return err
+	}
+	// json roundtrip the document to ensure nested maps are map[string]any (retaining the precision of numbers)
+	documentBytes, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	document = map[string]any{}
+	err = unmarshalJsonNumbers(documentBytes, &document)
+	if err != nil {
+		return err
+	}
+
+	patch := map[string]any{}
+	// leaves and branches map (resolved) key paths to the variable that set (or nested beneath) them - used to detect conflicting overlays
+	leaves := Map[string, string]{}
+	branches := Map[string, string]{}
+	for _, overlay := range overlays {
+		current := any(document)
+		target := patch
+		resolved := []string{}
+		for index, key := range overlay.keys {
+			currentMap, _ := current.(map[string]any)
+			for candidate := range currentMap {
+				if strings.EqualFold(candidate, key) {
+					key = candidate
+					break
+				}
+			}
+			current = currentMap[key]
+			resolved = append(resolved, key)
+			keyPath := strings.Join(resolved, "\x00")
+			if other, ok := leaves[keyPath]; ok {
+				return fmt.Errorf("%s: conflicts with %s", overlay.variable, other)
+			}
+			if index == len(overlay.keys)-1 {
+				if other, ok := branches[keyPath]; ok {
+					return fmt.Errorf("%s: conflicts with %s", overlay.variable, other)
+				}
+				value, err := coerceConfigValue(overlay.value, current)
+				if err != nil {
+					return fmt.Errorf("%s: %w", overlay.variable, err)
+				}
+				leaves[keyPath] = overlay.variable
+				target[key] = value
+				break
+			}
+			branches[keyPath] = overlay.variable
+			next, ok := target[key].(map[string]any)
+			if !ok {
+				next = map[string]any{}
+				target[key] = next
+			}
+			target = next
+		}
+	}
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	return PatchFileAs(ctx, path, patchBytes, format)
+}
+
+// Applies config overlays defined by environment variables to the entrypoint's config files (see: [ConfigFiles]).
+// Variables follow the convention 'GSH_CFG__<file>__<key>[__<key>...]=<value>' where file is a config file's name (or the base name of its path) and keys address nested keys (e.g., an INI section and key).
+// Values are coerced into the type of the key's existing value (see: [coerceConfigValue]).
+// Should be called once the config files have been written (e.g., after rendering templates).
+// Overlays found within the environment are logged (see: [reportConfigOverlays]) before they are applied.
+// Returns an error if any overlay is rejected (i.e., malformed, unknown or disallowed - see: [ConfigOverlayAllowlist]).
+// Returns an error if any config file cannot be patched.
+func ApplyConfigOverlays(ctx context.Context) error {
+	reportConfigOverlays(ctx)
+	overlays := getConfigOverlays(ctx)
+	errs := []error{}
+	byPath := Map[string, []configOverlay]{}
+	for _, overlay := range overlays {
+		if overlay.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", overlay.variable, overlay.err))
+			continue
+		}
+		byPath[overlay.path] = append(byPath[overlay.path], overlay)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	paths := byPath.Keys()
+	slices.Sort(paths)
+	for _, path := range paths {
+		Logger(ctx).Info("apply config overlays", "path", path, "count", len(byPath[path]))
+		err := applyConfigOverlays(ctx, path, byPath[path])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns a callback that runs a config subcommand:
+//
+//	check - validates the entrypoint's configuration (see: [ValidateConfig]) without starting anything
+//
+// Invalid configurations are reported before subcommands run (see: [Entrypoint.main]) - the check subcommand is only reached once the configuration is valid.
+func configCommand(args ...string) entrypointCb {
+	return func(ctx context.Context) error {
+		if len(args) == 0 {
+			return fmt.Errorf("config command unset")
+		}
+		switch args[0] {
+		case "check":
+			fmt.Println("config valid")
+			return nil
+		}
+		return fmt.Errorf("unknown config command %s", args[0])
+	}
+}
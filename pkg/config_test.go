@@ -0,0 +1,112 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func init() {
+	testContextValues[ctxKeyConfigFiles{}] = func() any { return Map[string, string]{} }
+	testContextValues[ctxKeyConfigOverlayAllowlist{}] = func() any { return []string(nil) }
+}
+
+func TestApplyConfigOverlays(t *testing.T) {
+	original := `{"Server": {"MaxPlayers": 10, "Owner": 76561198000000000, "Rate": 1.5}}`
+	tests := []struct {
+		name      string
+		env       Map[string, string]
+		expectErr string
+		expected  Map[string, string]
+	}{
+		{name: "integer", env: Map[string, string]{"GSH_CFG__settings__server__maxplayers": "20"}, expected: Map[string, string]{"MaxPlayers": "20", "Owner": "76561198000000000", "Rate": "1.5"}},
+		{name: "large integer", env: Map[string, string]{"GSH_CFG__settings__Server__Owner": "76561198000000001"}, expected: Map[string, string]{"MaxPlayers": "10", "Owner": "76561198000000001", "Rate": "1.5"}},
+		{name: "float", env: Map[string, string]{"GSH_CFG__settings__Server__Rate": "2"}, expected: Map[string, string]{"MaxPlayers": "10", "Owner": "76561198000000000", "Rate": "2"}},
+		{name: "rejects non-integer for integer", env: Map[string, string]{"GSH_CFG__settings__Server__MaxPlayers": "20.5"}, expectErr: "GSH_CFG__settings__Server__MaxPlayers"},
+		{name: "rejects key and nested key", env: Map[string, string]{"GSH_CFG__settings__Server": "{}", "GSH_CFG__settings__Server__MaxPlayers": "20"}, expectErr: "conflicts with GSH_CFG__settings__Server"},
+		{name: "rejects same key", env: Map[string, string]{"GSH_CFG__settings__Server__MaxPlayers": "20", "GSH_CFG__settings__server__maxplayers": "30"}, expectErr: "conflicts with"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "settings.json")
+			err := os.WriteFile(file, []byte(original), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for variable, value := range test.env {
+				t.Setenv(variable, value)
+			}
+			ctx := newTestContext(t)
+			ctx = context.WithValue(ctx, ctxKeyConfigFiles{}, Map[string, string]{"settings": file})
+
+			err = ApplyConfigOverlays(ctx)
+			if test.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectErr) {
+					t.Fatalf("error %v (expected %q)", err, test.expectErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			document := map[string]map[string]any{}
+			err = unmarshalJsonNumbers(data, &document)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, expected := range test.expected {
+				actual, _ := document["Server"][key].(interface{ String() string })
+				if actual == nil || actual.String() != expected {
+					t.Fatalf("%s is %v (expected %s)", key, document["Server"][key], expected)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigOverlaysReportedWhenApplied(t *testing.T) {
+	t.Setenv("GSH_CFG__unknown__key", "value")
+
+	// subcommands that don't apply overlays (e.g., health checks) must not report them
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = writer
+	entrypoint := Entrypoint{Main: func(ctx context.Context) error { return nil }, StatusFile: filepath.Join(t.TempDir(), "status"), Version: "1.0.0"}
+	_ = captureTestStdout(t, func() {
+		err = entrypoint.main("helper", "version")
+	})
+	os.Stderr = stderr
+	writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(output), "config overlay") {
+		t.Fatalf("overlays reported during initialization: %q", output)
+	}
+
+	buffer := bytes.Buffer{}
+	ctx := context.WithValue(newTestContext(t), ctxKeyLogger{}, slog.New(slog.NewTextHandler(&buffer, nil)))
+	err = ApplyConfigOverlays(ctx)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(buffer.String(), "config overlay rejected") || !strings.Contains(buffer.String(), "GSH_CFG__unknown__key") {
+		t.Fatalf("overlays not reported: %q", buffer.String())
+	}
+}
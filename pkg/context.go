@@ -5,6 +5,31 @@ import (
 	"log/slog"
 )
 
+// ctxKeyBackupConfig is a context key pointing to the entrypoint's backup configuration
+type ctxKeyBackupConfig struct{}
+
+// Retrieves the entrypoint's backup configuration from the given context
+func BackupConfig(ctx context.Context) BackupOpts {
+	return ctx.Value(ctxKeyBackupConfig{}).(BackupOpts)
+}
+
+// ctxKeyConfigFiles is a context key pointing a mapping of [name] -> config file path
+type ctxKeyConfigFiles struct{}
+
+// Retrieves a mapping of [name] -> config file path from the given context.
+func ConfigFiles(ctx context.Context) Map[string, string] {
+	return ctx.Value(ctxKeyConfigFiles{}).(Map[string, string])
+}
+
+// ctxKeyConfigOverlayAllowlist is a context key pointing to the config overlay allowlist
+type ctxKeyConfigOverlayAllowlist struct{}
+
+// Retrieves the config overlay allowlist (i.e., the config file keys that can be overridden via environment variables - nil permits every key) from the given context.
+// See: [ApplyConfigOverlays]
+func ConfigOverlayAllowlist(ctx context.Context) []string {
+	return ctx.Value(ctxKeyConfigOverlayAllowlist{}).([]string)
+}
+
 // ctxKeyDirs is a context key pointing a mapping of [name] -> path
 type ctxKeyDirs struct{}
 
@@ -13,6 +38,22 @@ func Dirs(ctx context.Context) Map[string, string] {
 	return ctx.Value(ctxKeyDirs{}).(Map[string, string])
 }
 
+// ctxKeyFileCacheBackend is a context key pointing to the name of the file cache storage backend
+type ctxKeyFileCacheBackend struct{}
+
+// Retrieves the name of the file cache storage backend used to store new items
+func FileCacheBackend(ctx context.Context) string {
+	return ctx.Value(ctxKeyFileCacheBackend{}).(string)
+}
+
+// ctxKeyFileCacheContentAddressed is a context key pointing to a boolean determining whether the file cache stores blobs by content hash
+type ctxKeyFileCacheContentAddressed struct{}
+
+// Gets whether the file cache stores blobs by content hash (deduplicating keys with identical content) from the context
+func FileCacheContentAddressed(ctx context.Context) bool {
+	return ctx.Value(ctxKeyFileCacheContentAddressed{}).(bool)
+}
+
 // ctxKeyFileCacheEnabled is a context key pointing boolean determining whether file caching is enabled
 type ctxKeyFileCacheEnabled struct{}
 
@@ -29,6 +70,14 @@ func FileCacheSizeLimit(ctx context.Context) int {
 	return ctx.Value(ctxKeyFileCacheSizeLimit{}).(int)
 }
 
+// ctxKeyFileCacheVerifyRate is a context key pointing to the fraction (0-1) of file cache retrievals that verify blob checksums
+type ctxKeyFileCacheVerifyRate struct{}
+
+// Retrieves the fraction (0-1) of file cache retrievals that verify blob checksums from the context
+func FileCacheVerifyRate(ctx context.Context) float64 {
+	return ctx.Value(ctxKeyFileCacheVerifyRate{}).(float64)
+}
+
 // ctxKeyLogger is a context key pointing to a logger
 type ctxKeyLogger struct{}
 
@@ -37,6 +86,54 @@ func Logger(ctx context.Context) *slog.Logger {
 	return ctx.Value(ctxKeyLogger{}).(*slog.Logger)
 }
 
+// ctxKeyMetrics is a context key pointing to the entrypoint's metrics registry
+type ctxKeyMetrics struct{}
+
+// Retrieves the entrypoint's metrics registry from the given context
+func Metrics(ctx context.Context) *metrics {
+	return ctx.Value(ctxKeyMetrics{}).(*metrics)
+}
+
+// ctxKeyRconConfig is a context key pointing to the entrypoint's rcon configuration
+type ctxKeyRconConfig struct{}
+
+// Retrieves the entrypoint's rcon configuration from the given context
+func RconConfig(ctx context.Context) RconOpts {
+	return ctx.Value(ctxKeyRconConfig{}).(RconOpts)
+}
+
+// ctxKeyReadiness is a context key pointing to the entrypoint's readiness tracker
+type ctxKeyReadiness struct{}
+
+// Retrieves the entrypoint's readiness tracker from the given context
+func ReadinessTracker(ctx context.Context) *readiness {
+	return ctx.Value(ctxKeyReadiness{}).(*readiness)
+}
+
+// ctxKeySecrets is a context key pointing to the entrypoint's secrets store
+type ctxKeySecrets struct{}
+
+// Retrieves the entrypoint's secrets store (i.e., the values redacted from log output) from the given context
+func Secrets(ctx context.Context) *secrets {
+	return ctx.Value(ctxKeySecrets{}).(*secrets)
+}
+
+// ctxKeySecretsDir is a context key pointing to the directory holding mounted secrets
+type ctxKeySecretsDir struct{}
+
+// Retrieves the directory holding mounted secrets (e.g., '/run/secrets') from the given context
+func SecretsDir(ctx context.Context) string {
+	return ctx.Value(ctxKeySecretsDir{}).(string)
+}
+
+// ctxKeyShutdown is a context key pointing to the entrypoint's shutdown hook chain
+type ctxKeyShutdown struct{}
+
+// Retrieves the entrypoint's shutdown hook chain from the given context
+func ShutdownConfig(ctx context.Context) *shutdown {
+	return ctx.Value(ctxKeyShutdown{}).(*shutdown)
+}
+
 // ctxKeyUuid is a context key pointing to a session uuid
 type ctxKeyUuid struct{}
 
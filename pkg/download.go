@@ -2,32 +2,453 @@ package helper
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
-// Downloads a url to the target path
-// Returns an error if the download fails.
-func Download(ctx context.Context, url string, dest string) error {
-	handle, err := os.Create(dest)
+// DownloadOpts defines the options used in conjunction with the [Download] function.
+// Checksum is formatted as '<algorithm>:<hex digest>' - where algorithm is one of 'sha256', 'sha1' or 'md5'.
+// Progress is logged every ProgressInterval (default: 10s - non-positive values use the default).
+// Transient failures (e.g., 5xx responses, interrupted transfers, checksum mismatches) are retried Retries times (default: 3 - a negative value disables retries) with an exponential backoff starting at RetryBackoff (default: 1s).
+type DownloadOpts struct {
+	Checksum         string
+	Headers          map[string]string
+	Password         string
+	ProgressInterval time.Duration
+	Retries          int
+	RetryBackoff     time.Duration
+	Timeout          time.Duration
+	Username         string
+}
+
+// downloadError is an error that signals whether a failed download attempt can be retried
+type downloadError struct {
+	err       error
+	retryable bool
+}
+
+// Returns the underlying error message
+func (de downloadError) Error() string {
+	return de.err.Error()
+}
+
+// Returns the underlying error
+func (de downloadError) Unwrap() error {
+	return de.err
+}
+
+// Parses a checksum string ('<algorithm>:<hex digest>') into a hash function and expected digest.
+// Returns an error if the checksum is malformed or uses an unsupported algorithm.
+func parseChecksum(checksum string) (func() hash.Hash, string, error) {
+	fail := func(err error) (func() hash.Hash, string, error) {
+		return nil, "", err
+	}
+
+	algorithm, digest, ok := strings.Cut(checksum, ":")
+	if !ok {
+		return fail(fmt.Errorf("checksum malformed %s", checksum))
+	}
+	digest = strings.ToLower(digest)
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		return md5.New, digest, nil
+	case "sha1":
+		return sha1.New, digest, nil
+	case "sha256":
+		return sha256.New, digest, nil
+	default:
+		return fail(fmt.Errorf("checksum algorithm unsupported %s", algorithm))
+	}
+}
+
+// Computes the hex digest of a file using the provided hash function.
+// Returns an error if the file is unreadable.
+func hashFile(path string, newHash func() hash.Hash) (string, error) {
+	handle, err := os.Open(path)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer handle.Close()
+	hasher := newHash()
+	_, err = io.CopyBuffer(hasher, handle, make([]byte, 1024*1024))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
 
-	Logger(ctx).Info("download", "url", url, "file", dest)
-	response, err := http.Get(url)
+// progressWriter counts the bytes written through it
+type progressWriter struct {
+	count  atomic.Int64
+	writer io.Writer
+}
+
+// Writes data to the underlying writer, counting the bytes written
+func (pw *progressWriter) Write(data []byte) (int, error) {
+	count, err := pw.writer.Write(data)
+	pw.count.Add(int64(count))
+	return count, err
+}
+
+// Returns the validator used to safely resume a partial download via If-Range - a strong ETag or, for servers that do not send strong ETags, a Last-Modified timestamp.
+// Returns an empty string if the response offers no usable validator.
+func getRangeValidator(response *http.Response) string {
+	etag := response.Header.Get("ETag")
+	if etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return response.Header.Get("Last-Modified")
+}
+
+// Parses the complete length of a resource from a Content-Range header (e.g., 'bytes 0-99/100' or 'bytes */100').
+// Returns -1 if the header is absent or the length is unknown.
+func getContentRangeLength(contentRange string) int64 {
+	_, length, ok := strings.Cut(contentRange, "/")
+	if !ok {
+		return -1
+	}
+	value, err := strconv.ParseInt(length, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return value
+}
+
+// Parses the first byte position of a Content-Range header (e.g., 'bytes 100-199/200').
+// Returns -1 if the header is absent or malformed.
+func getContentRangeStart(contentRange string) int64 {
+	unit, rest, ok := strings.Cut(contentRange, " ")
+	if !ok || unit != "bytes" {
+		return -1
+	}
+	start, _, ok := strings.Cut(rest, "-")
+	if !ok {
+		return -1
+	}
+	value, err := strconv.ParseInt(start, 10, 64)
 	if err != nil {
-		return err
+		return -1
+	}
+	return value
+}
+
+// Performs a single download attempt - resuming the partial file if it exists and the server supports range requests.
+// Partial files are only resumed with an If-Range validator (recorded in '<partial>.validator') - if the resource has changed, the server replies with the full resource and the download restarts.
+// A partial file rejected as unsatisfiable (416) is treated as complete if its size matches the resource's length - otherwise the download restarts.
+// Returns a [downloadError] if the attempt fails.
+func downloadAttempt(ctx context.Context, url string, partial string, opts DownloadOpts) error {
+	fail := func(err error, retryable bool) error {
+		return downloadError{err: err, retryable: retryable}
+	}
+
+	if opts.Timeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	validatorFile := partial + ".validator"
+	offset := int64(0)
+	validator := ""
+	lstat, err := os.Lstat(partial)
+	if err == nil {
+		offset = lstat.Size()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fail(err, false)
+	}
+	if offset > 0 {
+		data, err := os.ReadFile(validatorFile)
+		if err == nil {
+			validator = strings.TrimSpace(string(data))
+		}
+		if validator == "" {
+			Logger(ctx).Info("partial download lacks validator - restarting download", "url", url)
+			offset = 0
+		}
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fail(err, false)
+	}
+	for key, value := range opts.Headers {
+		request.Header.Set(key, value)
+	}
+	if opts.Username != "" || opts.Password != "" {
+		request.SetBasicAuth(opts.Username, opts.Password)
+	}
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		request.Header.Set("If-Range", validator)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return fail(err, true)
 	}
 	defer response.Body.Close()
-	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("GET %s sent non-200 status code: %d", url, response.StatusCode)
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch response.StatusCode {
+	case http.StatusOK:
+		flags |= os.O_TRUNC
+		if offset > 0 {
+			Logger(ctx).Info("server sent full response - restarting download", "url", url)
+		}
+		offset = 0
+		validator = getRangeValidator(response)
+		if validator == "" {
+			err = RemovePaths(ctx, validatorFile)
+		} else {
+			err = os.WriteFile(validatorFile, []byte(validator), 0644)
+		}
+		if err != nil {
+			return fail(err, false)
+		}
+	case http.StatusPartialContent:
+		start := getContentRangeStart(response.Header.Get("Content-Range"))
+		if start != offset {
+			RemovePaths(ctx, partial, validatorFile)
+			return fail(fmt.Errorf("GET %s sent unexpected range %s - restarting download", url, response.Header.Get("Content-Range")), true)
+		}
+		flags |= os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		if offset > 0 && getContentRangeLength(response.Header.Get("Content-Range")) == offset {
+			Logger(ctx).Info("partial download already complete", "url", url, "bytes", offset)
+			return nil
+		}
+		response.Body.Close()
+		err = RemovePaths(ctx, partial, validatorFile)
+		if err != nil {
+			return fail(err, false)
+		}
+		if offset == 0 {
+			return fail(fmt.Errorf("GET %s sent non-200 status code: %d", url, response.StatusCode), false)
+		}
+		Logger(ctx).Info("server rejected range request - restarting download", "url", url)
+		return downloadAttempt(ctx, url, partial, opts)
+	default:
+		retryable := response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusRequestTimeout
+		return fail(fmt.Errorf("GET %s sent non-200 status code: %d", url, response.StatusCode), retryable)
 	}
 
+	handle, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		return fail(err, false)
+	}
+	defer handle.Close()
+
+	total := int64(-1)
+	if response.ContentLength >= 0 {
+		total = offset + response.ContentLength
+	}
+	if offset > 0 {
+		Logger(ctx).Info("resume download", "url", url, "offset", offset)
+	}
+
+	writer := &progressWriter{writer: handle}
+	writer.count.Store(offset)
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(opts.ProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				Logger(ctx).Info("download progress", "url", url, "bytes", writer.count.Load(), "total", total)
+			}
+		}
+	}()
+
 	chunkSize := 1024 * 1024
-	_, err = io.CopyBuffer(handle, response.Body, make([]byte, chunkSize))
-	return err
+	_, err = io.CopyBuffer(writer, response.Body, make([]byte, chunkSize))
+	AddCounter(ctx, "gsh_download_bytes_total", "Number of bytes downloaded", float64(writer.count.Load()-offset), nil)
+	if err != nil {
+		return fail(err, true)
+	}
+	return nil
+}
+
+// Downloads a url to the target path - optionally configured by (at most one) [DownloadOpts].
+// Data is downloaded to a partial file ('<dest>.partial') that is atomically renamed to dest once the download completes (and, if configured, its checksum is verified).
+// Interrupted downloads are resumed via HTTP range requests (guarded by If-Range), and failed attempts are retried with an exponential backoff.
+// Returns an error if the download fails.
+// Returns an error if the downloaded file's checksum does not match the expected checksum.
+func Download(ctx context.Context, url string, dest string, opts ...DownloadOpts) error {
+	downloadOpts := DownloadOpts{}
+	if len(opts) > 0 {
+		downloadOpts = opts[0]
+	}
+	var newHash func() hash.Hash
+	digest := ""
+	if downloadOpts.Checksum != "" {
+		var err error
+		newHash, digest, err = parseChecksum(downloadOpts.Checksum)
+		if err != nil {
+			return err
+		}
+	}
+	if downloadOpts.ProgressInterval <= 0 {
+		downloadOpts.ProgressInterval = 10 * time.Second
+	}
+	if downloadOpts.Retries == 0 {
+		downloadOpts.Retries = 3
+	}
+	if downloadOpts.RetryBackoff <= 0 {
+		downloadOpts.RetryBackoff = 1 * time.Second
+	}
+
+	Logger(ctx).Info("download", "url", url, "file", dest)
+	start := time.Now()
+	defer func() {
+		ObserveDuration(ctx, "gsh_download_duration_seconds", "Time spent downloading files", time.Since(start), nil)
+	}()
+	partial := dest + ".partial"
+	validatorFile := partial + ".validator"
+	backoff := downloadOpts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := downloadAttempt(ctx, url, partial, downloadOpts)
+		if err == nil && newHash != nil {
+			var actual string
+			actual, err = hashFile(partial, newHash)
+			if err == nil && actual != digest {
+				RemovePaths(ctx, partial, validatorFile)
+				err = downloadError{err: fmt.Errorf("checksum mismatch for %s (%s != %s)", url, actual, digest), retryable: true}
+			}
+		}
+		if err == nil {
+			RemovePaths(ctx, validatorFile)
+			return os.Rename(partial, dest)
+		}
+
+		dlErr := downloadError{}
+		retryable := errors.As(err, &dlErr) && dlErr.retryable
+		if !retryable || attempt >= downloadOpts.Retries || ctx.Err() != nil {
+			return err
+		}
+		Logger(ctx).Warn("download failed - retrying", "url", url, "error", err.Error(), "attempt", attempt+1, "backoff", backoff.String())
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// CachedDownloadOpts defines the options used in conjunction with the [CachedDownload] function.
+// When Extract is set, the downloaded archive is extracted into the destination directory (and the extracted contents are cached).
+type CachedDownloadOpts struct {
+	Download DownloadOpts
+	Extract  bool
+	TTL      time.Duration
+}
+
+// Derives a file cache key from a url, its expected checksum and whether the download is extracted
+func getCachedDownloadKey(url string, checksum string, extract bool) string {
+	digest := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%t", url, checksum, extract)))
+	return fmt.Sprintf("download-%s", hex.EncodeToString(digest[:]))
+}
+
+// Returns a callback that revalidates a cached download via a conditional HTTP HEAD request.
+// Validators are ETags - or, for servers that do not send ETags, Last-Modified timestamps (prefixed with 'last-modified:').
+// Returns the current validator (which is unchanged if the server responds with '304 Not Modified').
+// Returns an error if the request fails.
+func getDownloadValidator(ctx context.Context, url string, opts DownloadOpts) fileCacheValidateCb {
+	return func(validator string) (string, error) {
+		if opts.Timeout > 0 {
+			var cancel func()
+			ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+			defer cancel()
+		}
+		request, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return "", err
+		}
+		for key, value := range opts.Headers {
+			request.Header.Set(key, value)
+		}
+		if opts.Username != "" || opts.Password != "" {
+			request.SetBasicAuth(opts.Username, opts.Password)
+		}
+		lastModified, ok := strings.CutPrefix(validator, "last-modified:")
+		if ok {
+			request.Header.Set("If-Modified-Since", lastModified)
+		} else if validator != "" {
+			request.Header.Set("If-None-Match", validator)
+		}
+
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			return "", err
+		}
+		defer response.Body.Close()
+		switch response.StatusCode {
+		case http.StatusNotModified:
+			return validator, nil
+		case http.StatusOK:
+		default:
+			return "", fmt.Errorf("HEAD %s sent non-200 status code: %d", url, response.StatusCode)
+		}
+		etag := response.Header.Get("ETag")
+		if etag != "" {
+			return etag, nil
+		}
+		lastModified = response.Header.Get("Last-Modified")
+		if lastModified != "" {
+			return fmt.Sprintf("last-modified:%s", lastModified), nil
+		}
+		return "", nil
+	}
+}
+
+// Downloads a url to the target path via the file cache (see: [CacheFile]).
+// The cache key is derived from the url and expected checksum.
+// Downloads with an expected checksum are immutable - otherwise, cached downloads are revalidated with HTTP conditional requests (ETag/If-None-Match or Last-Modified/If-Modified-Since) once their TTL expires.
+// When configured to extract, the downloaded archive is extracted into the target path (see: [Extract]).
+// Returns an error if the download fails.
+// Returns an error if the extraction fails.
+// Returns an error if any file cache operation fails.
+func CachedDownload(ctx context.Context, url string, dest string, opts CachedDownloadOpts) error {
+	key := getCachedDownloadKey(url, opts.Download.Checksum, opts.Extract)
+	cacheOpts := CacheFileOpts{TTL: opts.TTL}
+	if opts.Download.Checksum == "" {
+		cacheOpts.Validate = getDownloadValidator(ctx, url, opts.Download)
+	}
+	Logger(ctx).Info("cached download", "url", url, "key", key, "dest", dest)
+	return CacheFile(ctx, key, dest, func(path string) error {
+		if !opts.Extract {
+			return Download(ctx, url, path, opts.Download)
+		}
+		return CreateTempDir(ctx, func(tempDir string) error {
+			name := "download"
+			parsed, err := neturl.Parse(url)
+			if err == nil && filepath.Base(parsed.Path) != "." && filepath.Base(parsed.Path) != "/" {
+				name = filepath.Base(parsed.Path)
+			}
+			archive := filepath.Join(tempDir, name)
+			err = Download(ctx, url, archive, opts.Download)
+			if err != nil {
+				return err
+			}
+			return Extract(ctx, archive, path)
+		})
+	}, cacheOpts)
 }
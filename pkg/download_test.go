@@ -0,0 +1,257 @@
+package helper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Starts an HTTP server serving content with the given ETag (supporting range and If-Range requests)
+func newTestDownloadServer(t *testing.T, content []byte, etag string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "file", time.Unix(0, 0), bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloadResume(t *testing.T) {
+	content := []byte("hello world")
+	server := newTestDownloadServer(t, content, `"v1"`)
+
+	tests := []struct {
+		name      string
+		partial   string
+		validator string
+	}{
+		{name: "resumes matching partial", partial: "hello", validator: `"v1"`},
+		{name: "restarts changed resource", partial: "HELLO WORLD!", validator: `"v0"`},
+		{name: "restarts partial without validator", partial: "HELLO"},
+		{name: "completes finished partial", partial: "hello world", validator: `"v1"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(t)
+			dest := filepath.Join(t.TempDir(), "file")
+			err := os.WriteFile(dest+".partial", []byte(test.partial), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.validator != "" {
+				err = os.WriteFile(dest+".partial.validator", []byte(test.validator), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = Download(ctx, server.URL, dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, content) {
+				t.Fatalf("downloaded %q (expected %q)", data, content)
+			}
+			for _, leftover := range []string{dest + ".partial", dest + ".partial.validator"} {
+				_, err = os.Stat(leftover)
+				if !os.IsNotExist(err) {
+					t.Fatalf("leftover file %s", leftover)
+				}
+			}
+		})
+	}
+}
+
+// Starts an HTTP server that fails the first failures requests (with a 503) before serving content - counting requests
+func newTestFlakyDownloadServer(t *testing.T, content []byte, failures int64, requests *atomic.Int64) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(content)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloadRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int64
+		retries   int
+		expectErr bool
+		requests  int64
+	}{
+		{name: "retries transient failures by default", failures: 2, requests: 3},
+		{name: "fails once retries are exhausted", failures: 5, expectErr: true, requests: 4},
+		{name: "negative retries disable retries", failures: 1, retries: -1, expectErr: true, requests: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(t)
+			requests := atomic.Int64{}
+			server := newTestFlakyDownloadServer(t, []byte("content"), test.failures, &requests)
+			dest := filepath.Join(t.TempDir(), "file")
+
+			err := Download(ctx, server.URL, dest, DownloadOpts{Retries: test.retries, RetryBackoff: time.Millisecond})
+			if test.expectErr != (err != nil) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if requests.Load() != test.requests {
+				t.Fatalf("sent %d requests (expected %d)", requests.Load(), test.requests)
+			}
+		})
+	}
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	ctx := newTestContext(t)
+	requests := atomic.Int64{}
+	server := newTestFlakyDownloadServer(t, []byte("content"), 0, &requests)
+	dest := filepath.Join(t.TempDir(), "file")
+
+	checksum := "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	err := Download(ctx, server.URL, dest, DownloadOpts{Checksum: checksum, RetryBackoff: time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("unexpected error %v (expected checksum mismatch)", err)
+	}
+	if requests.Load() != 4 {
+		t.Fatalf("sent %d requests (expected mismatches to be retried)", requests.Load())
+	}
+	for _, path := range []string{dest, dest + ".partial"} {
+		_, err = os.Stat(path)
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("%s left behind (error: %v)", path, err)
+		}
+	}
+}
+
+func TestDownloadNegativeProgressInterval(t *testing.T) {
+	ctx := newTestContext(t)
+	requests := atomic.Int64{}
+	server := newTestFlakyDownloadServer(t, []byte("content"), 0, &requests)
+	dest := filepath.Join(t.TempDir(), "file")
+
+	err := Download(ctx, server.URL, dest, DownloadOpts{ProgressInterval: -time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testCachedDownloadServer serves mutable content (supporting conditional requests) - counting requests by method
+type testCachedDownloadServer struct {
+	content  atomic.Value
+	etag     atomic.Value
+	gets     atomic.Int64
+	heads    atomic.Int64
+	modified atomic.Value
+	server   *httptest.Server
+}
+
+// Starts a [testCachedDownloadServer] serving content with the given ETag (omitted when empty - relying on Last-Modified)
+func newTestCachedDownloadServer(t *testing.T, content string, etag string) *testCachedDownloadServer {
+	t.Helper()
+	ts := &testCachedDownloadServer{}
+	ts.set(content, etag, time.Unix(1000, 0))
+	ts.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			ts.heads.Add(1)
+		} else {
+			ts.gets.Add(1)
+		}
+		if etag := ts.etag.Load().(string); etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		http.ServeContent(w, r, "file", ts.modified.Load().(time.Time), strings.NewReader(ts.content.Load().(string)))
+	}))
+	t.Cleanup(ts.server.Close)
+	return ts
+}
+
+// Changes the served content
+func (ts *testCachedDownloadServer) set(content string, etag string, modified time.Time) {
+	ts.content.Store(content)
+	ts.etag.Store(etag)
+	ts.modified.Store(modified)
+}
+
+func TestCachedDownloadRevalidation(t *testing.T) {
+	tests := []struct {
+		name string
+		etag string
+	}{
+		{name: "etag", etag: `"v1"`},
+		{name: "last modified", etag: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestCacheContext(t)
+			ts := newTestCachedDownloadServer(t, "v1", test.etag)
+			dir := t.TempDir()
+			download := func(name string) string {
+				dest := filepath.Join(dir, name)
+				err := CachedDownload(ctx, ts.server.URL, dest, CachedDownloadOpts{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err := os.ReadFile(dest)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return string(data)
+			}
+
+			if download("first") != "v1" || ts.gets.Load() != 1 {
+				t.Fatalf("initial download failed (gets: %d)", ts.gets.Load())
+			}
+			// an unchanged resource is served from the cache ('304 Not Modified')
+			if download("second") != "v1" || ts.gets.Load() != 1 {
+				t.Fatalf("unchanged resource re-downloaded (gets: %d)", ts.gets.Load())
+			}
+			etag := ""
+			if test.etag != "" {
+				etag = `"v2"`
+			}
+			ts.set("v2", etag, time.Unix(2000, 0))
+			if download("third") != "v2" || ts.gets.Load() != 2 {
+				t.Fatalf("changed resource not re-downloaded (gets: %d)", ts.gets.Load())
+			}
+			if ts.heads.Load() != 3 {
+				t.Fatalf("sent %d HEAD requests (expected one per lookup)", ts.heads.Load())
+			}
+		})
+	}
+}
+
+func TestCachedDownloadChecksumImmutable(t *testing.T) {
+	ctx := newTestCacheContext(t)
+	ts := newTestCachedDownloadServer(t, "v1", `"v1"`)
+	dir := t.TempDir()
+	checksum := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("v1")))
+
+	for _, name := range []string{"first", "second"} {
+		err := CachedDownload(ctx, ts.server.URL, filepath.Join(dir, name), CachedDownloadOpts{Download: DownloadOpts{Checksum: checksum}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ts.gets.Load() != 1 || ts.heads.Load() != 0 {
+		t.Fatalf("sent %d GET and %d HEAD requests (expected a single GET)", ts.gets.Load(), ts.heads.Load())
+	}
+}
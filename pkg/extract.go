@@ -1,35 +1,481 @@
 package helper
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 )
 
+// archiveFormat identifies the format of an archive
+type archiveFormat string
+
+const (
+	archiveFormat7z       archiveFormat = "7z"
+	archiveFormatRar      archiveFormat = "rar"
+	archiveFormatTar      archiveFormat = "tar"
+	archiveFormatTarBzip2 archiveFormat = "tar.bz2"
+	archiveFormatTarGzip  archiveFormat = "tar.gz"
+	archiveFormatTarXz    archiveFormat = "tar.xz"
+	archiveFormatTarZstd  archiveFormat = "tar.zst"
+	archiveFormatZip      archiveFormat = "zip"
+)
+
+// archiveSignature is a sequence of magic bytes (at a given offset) that identify an [archiveFormat]
+type archiveSignature struct {
+	format archiveFormat
+	magic  []byte
+	offset int
+}
+
+// archiveSignatures is the list of signatures used to sniff an archive's format
+var archiveSignatures = []archiveSignature{
+	{format: archiveFormat7z, magic: []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}},
+	{format: archiveFormatRar, magic: []byte{'R', 'a', 'r', '!', 0x1a, 0x07}},
+	{format: archiveFormatTarBzip2, magic: []byte{'B', 'Z', 'h'}},
+	{format: archiveFormatTarGzip, magic: []byte{0x1f, 0x8b}},
+	{format: archiveFormatTarXz, magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{format: archiveFormatTarZstd, magic: []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{format: archiveFormatZip, magic: []byte{'P', 'K', 0x03, 0x04}},
+	{format: archiveFormatZip, magic: []byte{'P', 'K', 0x05, 0x06}},
+	{format: archiveFormatTar, magic: []byte{'u', 's', 't', 'a', 'r'}, offset: 257},
+}
+
+// Determines the format of an archive by inspecting its leading bytes.
+// Falls back to the file extension for formats lacking a reliable signature (e.g., v7 tar archives).
+// Returns an error if the archive is unreadable.
+// Returns an error if the archive format is unrecognized.
+func detectArchiveFormat(ctx context.Context, src string) (archiveFormat, error) {
+	fail := func(err error) (archiveFormat, error) {
+		return "", err
+	}
+
+	handle, err := os.Open(src)
+	if err != nil {
+		return fail(err)
+	}
+	defer handle.Close()
+	header := make([]byte, 512)
+	count, err := io.ReadFull(handle, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return fail(err)
+	}
+	header = header[:count]
+
+	for _, signature := range archiveSignatures {
+		end := signature.offset + len(signature.magic)
+		if end > len(header) {
+			continue
+		}
+		if bytes.Equal(header[signature.offset:end], signature.magic) {
+			return signature.format, nil
+		}
+	}
+	if strings.HasSuffix(src, ".tar") {
+		return archiveFormatTar, nil
+	}
+	return fail(fmt.Errorf("unrecognized file type %s", src))
+}
+
+// Returns true if path is dest or is located within dest
+func extractWithin(dest string, path string) bool {
+	return path == dest || strings.HasPrefix(path, dest+string(os.PathSeparator))
+}
+
+// Joins an archive member's name to the destination directory.
+// Returns an error if the resulting path escapes the destination directory (i.e., 'zip slip').
+func extractJoin(dest string, name string) (string, error) {
+	path := filepath.Join(dest, name)
+	if !extractWithin(dest, path) {
+		return "", fmt.Errorf("archive path escapes destination %s", name)
+	}
+	return path, nil
+}
+
+// extractor holds state associated with a single extraction operation
+type extractor struct {
+	ctx      context.Context
+	dest     string
+	dirModes Map[string, fs.FileMode]
+}
+
+// Resolves the on-disk location of a path by following any symlinks along it (e.g., symlinks created by earlier archive members).
+// Components that do not yet exist are appended to the resolved location of the nearest existing ancestor.
+// Returns an error if the path resolves to a location outside of the destination directory.
+func (e *extractor) resolve(path string) (string, error) {
+	existing := path
+	missing := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			resolved = filepath.Join(resolved, missing)
+			if !extractWithin(e.dest, resolved) {
+				return "", fmt.Errorf("archive path escapes destination via symlink %s", path)
+			}
+			return resolved, nil
+		}
+		parent := filepath.Dir(existing)
+		if !errors.Is(err, os.ErrNotExist) || parent == existing {
+			return "", err
+		}
+		missing = filepath.Join(filepath.Base(existing), missing)
+		existing = parent
+	}
+}
+
+// Creates an extractor for the destination directory - creating the directory and resolving it to its on-disk location (see: [extractor.resolve]).
+// Returns an error if the destination directory cannot be created or resolved.
+func newExtractor(ctx context.Context, dest string) (*extractor, error) {
+	fail := func(err error) (*extractor, error) {
+		return nil, err
+	}
+
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return fail(err)
+	}
+	err = CreateDirs(ctx, dest)
+	if err != nil {
+		return fail(err)
+	}
+	dest, err = filepath.EvalSymlinks(dest)
+	if err != nil {
+		return fail(err)
+	}
+	return &extractor{ctx: ctx, dest: dest, dirModes: Map[string, fs.FileMode]{}}, nil
+}
+
+// Creates a directory at the given path.
+// The directory's mode is applied once extraction completes (see: [extractor.finalize]) so that read-only directories can still be populated.
+// Returns an error if the directory resolves to a location outside of the destination directory.
+// Returns an error if the directory cannot be created.
+func (e *extractor) dir(path string, mode fs.FileMode) error {
+	path, err := e.resolve(path)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(path, 0755)
+	if err != nil {
+		return err
+	}
+	e.dirModes[path] = mode.Perm()
+	return nil
+}
+
+// Creates a regular file at the given path with the provided contents and mode.
+// Any existing path (including symlinks) is replaced rather than written through.
+// Returns an error if the file's parent directory resolves to a location outside of the destination directory.
+// Returns an error if the file cannot be written.
+func (e *extractor) file(path string, mode fs.FileMode, modTime time.Time, reader io.Reader) error {
+	path, err := e.prepare(path)
+	if err != nil {
+		return err
+	}
+	handle, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode.Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyBuffer(handle, reader, make([]byte, 1024*1024))
+	closeErr := handle.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	err = os.Chmod(path, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if !modTime.IsZero() {
+		return os.Chtimes(path, modTime, modTime)
+	}
+	return nil
+}
+
+// Applies deferred directory modes.
+// Returns an error if any chmod operation fails.
+func (e *extractor) finalize() error {
+	for path, mode := range e.dirModes {
+		err := os.Chmod(path, mode)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Creates a hard link at the given path pointing to another member of the archive.
+// Returns an error if the link target escapes the destination directory.
+// Returns an error if the link cannot be created.
+func (e *extractor) link(path string, target string) error {
+	targetPath, err := extractJoin(e.dest, target)
+	if err != nil {
+		return err
+	}
+	targetParent, err := e.resolve(filepath.Dir(targetPath))
+	if err != nil {
+		return err
+	}
+	path, err = e.prepare(path)
+	if err != nil {
+		return err
+	}
+	return os.Link(filepath.Join(targetParent, filepath.Base(targetPath)), path)
+}
+
+// Prepares a path for writing by creating its parent directory and removing any existing non-directory at the path.
+// Returns the path with its parent directory resolved on disk (see: [extractor.resolve]) - writes never pass through symlinks leading outside of the destination directory.
+// Returns an error if this process fails.
+func (e *extractor) prepare(path string) (string, error) {
+	fail := func(err error) (string, error) {
+		return "", err
+	}
+
+	parent, err := e.resolve(filepath.Dir(path))
+	if err != nil {
+		return fail(err)
+	}
+	path = filepath.Join(parent, filepath.Base(path))
+	err = os.MkdirAll(parent, 0755)
+	if err != nil {
+		return fail(err)
+	}
+	lstat, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return path, nil
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if lstat.IsDir() {
+		return fail(fmt.Errorf("cannot replace directory %s", path))
+	}
+	return path, os.Remove(path)
+}
+
+// Creates a symlink at the given path.
+// The target is resolved relative to the on-disk location of the symlink's parent directory - accounting for symlinks created by earlier archive members.
+// Returns an error if the symlink resolves to a location outside of the destination directory.
+// Returns an error if the symlink cannot be created.
+func (e *extractor) symlink(path string, target string) error {
+	if filepath.IsAbs(target) {
+		return fmt.Errorf("archive symlink target is absolute %s -> %s", path, target)
+	}
+	path, err := e.prepare(path)
+	if err != nil {
+		return err
+	}
+	_, err = e.resolve(filepath.Join(filepath.Dir(path), target))
+	if err != nil {
+		return fmt.Errorf("archive symlink escapes destination %s -> %s: %w", path, target, err)
+	}
+	return os.Symlink(target, path)
+}
+
+// Extracts a tar stream into the destination directory.
+// Returns an error if the stream is not a valid tar archive.
+// Returns an error if any member fails to extract.
+func (e *extractor) tar(reader io.Reader) error {
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		path, err := extractJoin(e.dest, header.Name)
+		if err != nil {
+			return err
+		}
+		mode := header.FileInfo().Mode()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = e.dir(path, mode)
+		case tar.TypeReg:
+			err = e.file(path, mode, header.ModTime, tarReader)
+		case tar.TypeSymlink:
+			err = e.symlink(path, header.Linkname)
+		case tar.TypeLink:
+			err = e.link(path, header.Linkname)
+		default:
+			Logger(e.ctx).Info("skip unsupported archive member", "name", header.Name, "type", string(header.Typeflag))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return e.finalize()
+}
+
+// Extracts a zip archive into the destination directory.
+// Returns an error if the file is not a valid zip archive.
+// Returns an error if any member fails to extract.
+func (e *extractor) zip(src string) error {
+	zipReader, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zipReader.Close()
+	for _, member := range zipReader.File {
+		path, err := extractJoin(e.dest, member.Name)
+		if err != nil {
+			return err
+		}
+		mode := member.Mode()
+		reader, err := member.Open()
+		if err != nil {
+			return err
+		}
+		if mode.IsDir() {
+			err = e.dir(path, mode)
+		} else if mode&fs.ModeSymlink != 0 {
+			var target []byte
+			target, err = io.ReadAll(reader)
+			if err == nil {
+				err = e.symlink(path, string(target))
+			}
+		} else {
+			err = e.file(path, mode, member.Modified, reader)
+		}
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return e.finalize()
+}
+
+// Opens a (possibly compressed) tar archive, returning a reader of the uncompressed tar stream.
+// Returns an error if the file cannot be opened.
+// Returns an error if the decompressor cannot be initialized.
+func openTarArchive(src string, format archiveFormat) (io.ReadCloser, error) {
+	fail := func(err error) (io.ReadCloser, error) {
+		return nil, err
+	}
+
+	handle, err := os.Open(src)
+	if err != nil {
+		return fail(err)
+	}
+	buffered := bufio.NewReaderSize(handle, 1024*1024)
+	var reader io.Reader
+	closer := func() error { return handle.Close() }
+	switch format {
+	case archiveFormatTar:
+		reader = buffered
+	case archiveFormatTarBzip2:
+		reader = bzip2.NewReader(buffered)
+	case archiveFormatTarGzip:
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			handle.Close()
+			return fail(err)
+		}
+		reader = gzipReader
+	case archiveFormatTarXz:
+		xzReader, err := xz.NewReader(buffered)
+		if err != nil {
+			handle.Close()
+			return fail(err)
+		}
+		reader = xzReader
+	case archiveFormatTarZstd:
+		zstdReader, err := zstd.NewReader(buffered)
+		if err != nil {
+			handle.Close()
+			return fail(err)
+		}
+		reader = zstdReader
+		closer = func() error {
+			zstdReader.Close()
+			return handle.Close()
+		}
+	default:
+		handle.Close()
+		return fail(fmt.Errorf("unsupported tar format %s", format))
+	}
+	return readCloser{Reader: reader, close: closer}, nil
+}
+
+// readCloser combines a reader with a custom close function
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+// Closes the underlying resources
+func (rc readCloser) Close() error {
+	return rc.close()
+}
+
+// Extracts an archive using external tools (for formats lacking a native implementation).
+// Returns an error if the extract command fails.
+func extractExternal(ctx context.Context, format archiveFormat, src string, dest string) error {
+	var cmd []string
+	switch format {
+	case archiveFormat7z:
+		cmd = []string{"7z", "x", src, fmt.Sprintf("-o%s", dest)}
+	case archiveFormatRar:
+		cmd = []string{"unrar", "-f", "-x", src, dest}
+	default:
+		return fmt.Errorf("unsupported external format %s", format)
+	}
+	_, err := Command(ctx, cmd, CmdOpts{}).Run()
+	return err
+}
+
 // Extracts a src archive to a dest folder.
+// The archive format is determined by the archive's contents rather than its file extension.
+// zip and tar (optionally gzip, bzip2, xz or zstd compressed) archives are extracted natively - preserving permissions and symlinks.
+// rar and 7z archives are extracted using external tools ('unrar' and '7z' respectively).
 // Returns a failure if the archive type is unrecongized.
+// Returns a failure if any archive member would be extracted outside of dest.
 // Returns a failure if the extract operation fails.
 func Extract(ctx context.Context, src string, dest string) error {
 	Logger(ctx).Info("extract", "src", src, "dest", dest)
 
-	err := CreateDirs(ctx, dest)
+	e, err := newExtractor(ctx, dest)
 	if err != nil {
 		return err
 	}
 
-	var cmd []string
-	if strings.HasSuffix(src, ".rar") {
-		cmd = []string{"unrar", "-f", "-x", src, dest}
-	} else if strings.HasSuffix(src, ".tar.gz") {
-		cmd = []string{"tar", "--overwrite", "-xzf", src, "-C", dest}
-	} else if strings.HasSuffix(src, ".zip") {
-		cmd = []string{"unzip", "-o", src, "-d", dest}
-	} else if strings.HasSuffix(src, ".7z") {
-		cmd = []string{"7z", "x", src, fmt.Sprintf("-o%s", dest)}
-	} else {
-		return fmt.Errorf("unrecongized file type %s", src)
+	format, err := detectArchiveFormat(ctx, src)
+	if err != nil {
+		return err
 	}
+	start := time.Now()
+	defer func() {
+		ObserveDuration(ctx, "gsh_extract_duration_seconds", "Time spent extracting archives", time.Since(start), Map[string, string]{"format": string(format)})
+	}()
 
-	_, err = Command(ctx, cmd, CmdOpts{}).Run()
-	return err
+	switch format {
+	case archiveFormat7z, archiveFormatRar:
+		return extractExternal(ctx, format, src, e.dest)
+	case archiveFormatZip:
+		return e.zip(src)
+	default:
+		reader, err := openTarArchive(src, format)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		return e.tar(reader)
+	}
 }
@@ -0,0 +1,124 @@
+package helper
+
+import (
+	"archive/tar"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testTarMember is a single member of a tar archive written by writeTestTar
+type testTarMember struct {
+	link string
+	name string
+	kind byte
+}
+
+// Writes a tar archive holding the given members to path
+func writeTestTar(t *testing.T, path string, members []testTarMember) {
+	t.Helper()
+	handle, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+	writer := tar.NewWriter(handle)
+	for _, member := range members {
+		header := &tar.Header{Linkname: member.link, Mode: 0755, Name: member.name, Typeflag: member.kind}
+		body := []byte{}
+		if member.kind == tar.TypeReg {
+			body = []byte("evil")
+			header.Mode = 0644
+			header.Size = int64(len(body))
+		}
+		err = writer.WriteHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = writer.Write(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Fails the test if a file named 'evil' exists within dir
+func assertNoEscape(t *testing.T, dir string) {
+	t.Helper()
+	_, err := os.Lstat(filepath.Join(dir, "evil"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("archive wrote outside of destination (err: %v)", err)
+	}
+}
+
+func TestExtractSymlinkChainEscape(t *testing.T) {
+	ctx := newTestContext(t)
+	root := t.TempDir()
+	src := filepath.Join(root, "archive.tar")
+	dest := filepath.Join(root, "dest")
+	writeTestTar(t, src, []testTarMember{
+		{name: "d1/", kind: tar.TypeDir},
+		{name: "d1/l", kind: tar.TypeSymlink, link: ".."},
+		{name: "d1/l/l2", kind: tar.TypeSymlink, link: ".."},
+		{name: "d1/l/l2/evil", kind: tar.TypeReg},
+	})
+
+	err := Extract(ctx, src, dest)
+	if err == nil {
+		t.Fatal("expected hostile archive to fail extraction")
+	}
+	assertNoEscape(t, root)
+}
+
+func TestExtractExistingSymlinkEscape(t *testing.T) {
+	ctx := newTestContext(t)
+	root := t.TempDir()
+	src := filepath.Join(root, "archive.tar")
+	dest := filepath.Join(root, "dest")
+	outside := filepath.Join(root, "outside")
+	for _, dir := range []string{dest, outside} {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := os.Symlink(outside, filepath.Join(dest, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestTar(t, src, []testTarMember{
+		{name: "link/evil", kind: tar.TypeReg},
+	})
+
+	err = Extract(ctx, src, dest)
+	if err == nil {
+		t.Fatal("expected write through escaping symlink to fail extraction")
+	}
+	assertNoEscape(t, outside)
+}
+
+func TestExtractSymlinkWithinDest(t *testing.T) {
+	ctx := newTestContext(t)
+	root := t.TempDir()
+	src := filepath.Join(root, "archive.tar")
+	dest := filepath.Join(root, "dest")
+	writeTestTar(t, src, []testTarMember{
+		{name: "real/", kind: tar.TypeDir},
+		{name: "alias", kind: tar.TypeSymlink, link: "real"},
+		{name: "alias/evil", kind: tar.TypeReg},
+	})
+
+	err := Extract(ctx, src, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(filepath.Join(dest, "real", "evil"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
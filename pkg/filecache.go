@@ -2,76 +2,140 @@ package helper
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"math"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
 	"slices"
+	"strconv"
+	"sync"
+	"syscall"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // fileCacheVersion is used to ensure that the on-disk file cache manifest uses an up-to-date schema
-const fileCacheVersion = "1"
+// (older manifests are upgraded via [fileCacheMigrations])
+const fileCacheVersion = "2"
 
 // fileCacheFetchCb is called during a 'put' to populate a destination path
 type fileCacheFetchCb func(path string) error
 
-// fileCacheItem is an item within the cache
+// errFileCacheCorrupt indicates that a blob within the file cache failed checksum verification or could not be decoded
+var errFileCacheCorrupt = errors.New("file cache blob corrupt")
+
+// fileCacheBlob is stored data within the cache - referenced by one or more [fileCacheItem] keys.
+// The checksum (of the stored blob, in 'algorithm:digest' form) is recorded at put time so that corruption can be detected.
+type fileCacheBlob struct {
+	Backend  string `json:"backend"`
+	Checksum string `json:"checksum"`
+	Id       string `json:"id"`
+	IsFile   bool   `json:"isFile"`
+	Path     string `json:"path"`
+	RefCount int    `json:"refCount"`
+	Size     int    `json:"size"`
+}
+
+// fileCacheValidateCb is called with the validator recorded for a cached item (e.g., an ETag or upstream version string - empty if none was recorded) and should return the current validator.
+// A changed validator marks the cached item as stale.
+type fileCacheValidateCb func(validator string) (string, error)
+
+// CacheFileOpts are options that control how a [CacheFile] item is revalidated
+type CacheFileOpts struct {
+	// TTL is the duration for which a cached item is considered fresh.  Zero means items never expire.
+	TTL time.Duration
+	// Validate (when set) is called to revalidate a cached item once its TTL expires (or on every lookup if TTL is zero)
+	Validate fileCacheValidateCb
+}
+
+// fileCacheItem is an item (i.e., a key) within the cache
 type fileCacheItem struct {
-	IsFile       bool      `json:"isFile"`
+	Blob         string    `json:"blob"`
 	Key          string    `json:"key"`
 	LastAccessed time.Time `json:"lastAccessed"`
 	LastUuid     string    `json:"lastUuid"`
-	Path         string    `json:"path"`
-	Size         int       `json:"size"`
+	StoredAt     time.Time `json:"storedAt"`
+	Validator    string    `json:"validator"`
 }
 
-// fileCache holds all the metadata associated with the file cache
+// fileCache holds all the metadata associated with the file cache.
+// When content addressed, blobs are identified by a hash of their content - allowing multiple keys to share a single blob.
+// Otherwise, each key is stored within its own blob.
 type fileCache struct {
-	contents  Map[string, fileCacheItem]
-	ctx       context.Context
-	dir       string
-	logger    *slog.Logger
-	sizeLimit int
-	uuid      string
+	backend          string
+	blobs            Map[string, fileCacheBlob]
+	contentAddressed bool
+	contents         Map[string, fileCacheItem]
+	ctx              context.Context
+	dir              string
+	logger           *slog.Logger
+	sizeLimit        int
+	uuid             string
+	verifyRate       float64
 }
 
+// fileCacheLocks holds in-process locks for file cache directories (by directory)
+var fileCacheLocks = sync.Map{}
+
 // fileCacheManifest represents file cache state persisted on-disk
 type fileCacheManifest struct {
+	Blobs    map[string]fileCacheBlob `json:"blobs"`
 	Contents map[string]fileCacheItem `json:"contents"`
 	Version  string                   `json:"version"`
 }
 
 // Cleans the [fileCache] by removing untracked files and non-existent files from the cache directory.
-// Also ensures non-existent records are removed from the cache contents map.
+// Also ensures non-existent records are removed from the cache contents map, and recomputes blob reference counts (removing unreferenced blobs).
 // Returns an error if the clean operation fails
 func (fc *fileCache) clean() error {
 	defer fc.save()
 	validPaths := map[string]bool{}
+	refCounts := Map[string, int]{}
 	for key, item := range fc.contents {
-		_, err := os.Lstat(item.Path)
-		if err == nil {
-			validPaths[item.Path] = true
+		_, ok := fc.blobs[item.Blob]
+		if ok {
+			refCounts[item.Blob] += 1
 			continue
 		}
-		if !errors.Is(err, os.ErrNotExist) {
+		fc.logger.Info("remove cache item with missing blob", "key", key, "blob", item.Blob)
+		delete(fc.contents, key)
+	}
+	for id, blob := range fc.blobs {
+		lstat, err := os.Lstat(blob.Path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
 			return err
 		}
-		fc.logger.Info("remove missing cache item", "key", key, "path", item.Path)
-		err = RemovePaths(fc.ctx, item.Path)
+		// a size mismatch indicates a truncated (or otherwise modified) blob
+		if err == nil && refCounts[id] > 0 && int(lstat.Size()) == blob.Size {
+			blob.RefCount = refCounts[id]
+			fc.blobs[id] = blob
+			validPaths[blob.Path] = true
+			continue
+		}
+		fc.logger.Info("remove missing, modified or unreferenced cache blob", "blob", id, "path", blob.Path)
+		err = RemovePaths(fc.ctx, blob.Path)
 		if err != nil {
 			return err
 		}
-		delete(fc.contents, key)
+		delete(fc.blobs, id)
+		for key, item := range fc.contents {
+			if item.Blob == id {
+				delete(fc.contents, key)
+			}
+		}
 	}
 	subpaths, err := ListDir(fc.ctx, fc.dir)
 	if err != nil {
 		return err
 	}
 	for _, subpath := range subpaths {
-		if subpath == fc.getManifestPath() {
+		if subpath == fc.getManifestPath() || subpath == fc.getLockPath() {
 			continue
 		}
 		_, ok := validPaths[subpath]
@@ -96,26 +160,36 @@ func (fc *fileCache) get(key string, dest string) error {
 	if !ok {
 		return fmt.Errorf("key not found %s", key)
 	}
-	if item.IsFile {
-		err := CreateDirs(fc.ctx, filepath.Dir(dest))
-		if err != nil {
-			return err
-		}
-		_, err = Command(fc.ctx, []string{"sh", "-c", fmt.Sprintf("unsquashfs -cat %s /path > %s", item.Path, dest)}, CmdOpts{}).Run()
+	blob, ok := fc.blobs[item.Blob]
+	if !ok {
+		return fmt.Errorf("blob not found %s", item.Blob)
+	}
+	backend, err := getFileCacheBackend(blob.Backend)
+	if err != nil {
+		return err
+	}
+	if fc.verifyRate >= 1 || rand.Float64() < fc.verifyRate {
+		err = fc.verifyBlob(blob)
 		if err != nil {
 			return err
 		}
+	}
+	if blob.IsFile {
+		err = CreateDirs(fc.ctx, filepath.Dir(dest))
 	} else {
-		err := CreateDirs(fc.ctx, dest)
-		if err != nil {
-			return err
-		}
-		_, err = Command(fc.ctx, []string{"unsquashfs", "-force", "-no-xattrs", "-dest", dest, item.Path}, CmdOpts{}).Run()
-		if err != nil {
-			return err
-		}
+		err = CreateDirs(fc.ctx, dest)
+	}
+	if err != nil {
+		return err
+	}
+	err = backend.get(fc.ctx, blob.Path, dest, blob.IsFile)
+	if errors.Is(err, errFileCacheCorrupt) && fc.ctx.Err() == nil {
+		return fmt.Errorf("blob %s: %w", blob.Id, err)
 	}
-	_, err := os.Lstat(dest)
+	if err != nil {
+		return err
+	}
+	_, err = os.Lstat(dest)
 	if err != nil {
 		return err
 	}
@@ -125,11 +199,147 @@ func (fc *fileCache) get(key string, dest string) error {
 	return err
 }
 
+// Evicts a blob (and every key referencing it) from the file cache.
+// Returns an error if the blob cannot be removed.
+func (fc *fileCache) evictBlob(id string) error {
+	defer fc.save()
+	blob, ok := fc.blobs[id]
+	if !ok {
+		return nil
+	}
+	fc.logger.Info("evict cache blob", "blob", id)
+	err := RemovePaths(fc.ctx, blob.Path)
+	if err != nil {
+		return err
+	}
+	delete(fc.blobs, id)
+	for key, item := range fc.contents {
+		if item.Blob == id {
+			delete(fc.contents, key)
+			AddCounter(fc.ctx, "gsh_file_cache_evictions_total", "Number of items evicted from the file cache", 1, nil)
+		}
+	}
+	return nil
+}
+
+// Verifies a blob against the checksum recorded when it was stored.
+// Blobs without a recorded checksum are not verified.
+// Returns an error wrapping [errFileCacheCorrupt] if the checksum does not match.
+// Returns an error if the blob cannot be read.
+func (fc *fileCache) verifyBlob(blob fileCacheBlob) error {
+	if blob.Checksum == "" {
+		return nil
+	}
+	fc.logger.Info("verify cache blob", "blob", blob.Id)
+	newHash, expected, err := parseChecksum(blob.Checksum)
+	if err != nil {
+		return err
+	}
+	actual, err := hashFile(blob.Path, newHash)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return fmt.Errorf("%w %s: checksum mismatch (%s != %s)", errFileCacheCorrupt, blob.Id, actual, expected)
+	}
+	return nil
+}
+
+// Determines whether a cached item is fresh - expiring it via its TTL and revalidating it via the validate callback.
+// Stale items that cannot be revalidated (i.e., the validate callback fails) are treated as fresh.
+// Returns the validator to record should the item be (re-)fetched.
+// Returns whether the item was revalidated (i.e., its TTL should be renewed - see: [fileCache.renew]).
+func (fc *fileCache) isFresh(item fileCacheItem, opts CacheFileOpts) (bool, string, bool) {
+	expired := opts.TTL > 0 && time.Since(item.StoredAt) > opts.TTL
+	if opts.Validate == nil || (opts.TTL > 0 && !expired) {
+		return !expired, item.Validator, false
+	}
+	fc.logger.Info("revalidate cache item", "key", item.Key, "validator", item.Validator)
+	validator, err := opts.Validate(item.Validator)
+	if err != nil {
+		fc.logger.Warn("cache item revalidation failed - serving stale item", "key", item.Key, "error", err.Error())
+		return true, item.Validator, false
+	}
+	if validator != item.Validator {
+		fc.logger.Info("cache item validator changed", "key", item.Key, "previous", item.Validator, "current", validator)
+		return false, validator, false
+	}
+	return true, validator, true
+}
+
+// Renews the TTL of a revalidated item - provided that the item still references the revalidated blob
+func (fc *fileCache) renew(revalidated fileCacheItem) {
+	item, ok := fc.contents[revalidated.Key]
+	if !ok || item.Blob != revalidated.Blob {
+		return
+	}
+	item.StoredAt = time.Now()
+	fc.contents[revalidated.Key] = item
+}
+
 // Returns the path to the manifest JSON file
 func (fc *fileCache) getManifestPath() string {
 	return filepath.Join(fc.dir, "manifest.json")
 }
 
+// Returns the path to the lock file used to coordinate access to the cache directory across processes
+func (fc *fileCache) getLockPath() string {
+	return filepath.Join(fc.dir, ".lock")
+}
+
+// Acquires exclusive access to the file cache - both within the current process (via a mutex) and across processes sharing the cache directory (via flock).
+// The lock file is opened read-only (flock does not require write access) so that a lock file created by root can still be locked by non-root processes.
+// Returns a function that releases the lock.
+// Returns an error if the lock cannot be acquired.
+func (fc *fileCache) lock() (func(), error) {
+	fail := func(err error) (func(), error) {
+		return nil, err
+	}
+
+	value, _ := fileCacheLocks.LoadOrStore(fc.dir, &sync.Mutex{})
+	mutex := value.(*sync.Mutex)
+	mutex.Lock()
+
+	err := CreateDirs(fc.ctx, fc.dir)
+	if err != nil {
+		mutex.Unlock()
+		return fail(err)
+	}
+	handle, err := os.OpenFile(fc.getLockPath(), os.O_CREATE|os.O_RDONLY, 0666)
+	if err != nil {
+		mutex.Unlock()
+		return fail(err)
+	}
+	fc.logger.Info("acquire file cache lock", "path", fc.getLockPath())
+	err = syscall.Flock(int(handle.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		handle.Close()
+		mutex.Unlock()
+		return fail(err)
+	}
+	return func() {
+		syscall.Flock(int(handle.Fd()), syscall.LOCK_UN)
+		handle.Close()
+		mutex.Unlock()
+	}, nil
+}
+
+// Runs a callback while holding the file cache lock (see: [fileCache.lock]).
+// The cache is (re-)initialized once the lock is acquired - the callback observes changes made by other processes while the lock was released.
+// Returns an error if the lock cannot be acquired, if initialization fails or if the callback fails.
+func (fc *fileCache) locked(callback func() error) error {
+	unlock, err := fc.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	err = fc.initialize()
+	if err != nil {
+		return err
+	}
+	return callback()
+}
+
 // Returns a boolean indicating whether the file cache has the given key
 func (fc *fileCache) hasKey(key string) bool {
 	_, ok := fc.contents[key]
@@ -153,6 +363,7 @@ func (fc *fileCache) initialize() error {
 // Loads on-disk state into the [fileCache] metadata.
 // Returns an error if this process fails.
 func (fc *fileCache) load() error {
+	fc.blobs = Map[string, fileCacheBlob]{}
 	fc.contents = Map[string, fileCacheItem]{}
 	_, err := os.Lstat(fc.getManifestPath())
 	if errors.Is(err, os.ErrNotExist) {
@@ -161,42 +372,87 @@ func (fc *fileCache) load() error {
 	if err != nil {
 		return err
 	}
-	data := fileCacheManifest{}
-	err = UnmarshalFile(fc.ctx, fc.getManifestPath(), &data)
+	raw := Map[string, any]{}
+	err = UnmarshalFile(fc.ctx, fc.getManifestPath(), &raw)
 	if err != nil {
 		fc.logger.Info("manifest unparseable")
 		return RemovePaths(fc.ctx, fc.getManifestPath())
 	}
-	if data.Version != fileCacheVersion {
-		fc.logger.Info("manifest version mismatch", "manifest", data.Version, "current", fileCacheVersion)
+	err = fc.migrate(raw)
+	if err != nil {
+		fc.logger.Info("manifest migration failed", "error", err.Error())
+		return RemovePaths(fc.ctx, fc.getManifestPath())
+	}
+	data := fileCacheManifest{}
+	err = remarshalJson(raw, &data)
+	if err != nil {
+		fc.logger.Info("manifest unparseable")
 		return RemovePaths(fc.ctx, fc.getManifestPath())
 	}
-	fc.contents = Map[string, fileCacheItem](data.Contents)
+	if data.Blobs != nil {
+		fc.blobs = Map[string, fileCacheBlob](data.Blobs)
+	}
+	if data.Contents != nil {
+		fc.contents = Map[string, fileCacheItem](data.Contents)
+	}
 	return nil
 }
 
 // Pops (removes) an item from the file cache.
+// Returns the number of bytes freed - which is zero if the item's blob is still referenced by other keys.
 // Returns an error if this process fails.
-func (fc *fileCache) pop(key string) error {
+func (fc *fileCache) pop(key string) (int, error) {
 	fc.logger.Info("file cache pop", "key", key)
-	item, ok := fc.contents[key]
+	_, ok := fc.contents[key]
 	if !ok {
-		return nil
+		return 0, nil
 	}
 	defer fc.save()
-	err := RemovePaths(fc.ctx, item.Path)
+	freed, err := fc.unref(key)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	AddCounter(fc.ctx, "gsh_file_cache_evictions_total", "Number of items evicted from the file cache", 1, nil)
+	return freed, nil
+}
+
+// Removes a key from the cache and decrements the reference count of its blob - removing the blob once it is no longer referenced.
+// Returns the number of bytes freed.
+// Returns an error if the blob cannot be removed.
+func (fc *fileCache) unref(key string) (int, error) {
+	item, ok := fc.contents[key]
+	if !ok {
+		return 0, nil
 	}
 	delete(fc.contents, key)
-	return nil
+	blob, ok := fc.blobs[item.Blob]
+	if !ok {
+		return 0, nil
+	}
+	blob.RefCount -= 1
+	if blob.RefCount > 0 {
+		fc.blobs[item.Blob] = blob
+		return 0, nil
+	}
+	fc.logger.Info("remove unreferenced cache blob", "blob", blob.Id)
+	err := RemovePaths(fc.ctx, blob.Path)
+	if err != nil {
+		return 0, err
+	}
+	delete(fc.blobs, item.Blob)
+	return blob.Size, nil
 }
 
-// Puts an item (by key) into the cache.
+// Puts an item (by key) into the cache - recording the provided validator alongside it.
+// The fetch callback runs without holding the file cache lock (fetches may be slow, e.g., multi-gigabyte downloads) - the lock is only held while the fetched data is committed to the cache.
+// An existing item with the same key is only replaced once the fetch callback succeeds.
 // Returns an error if the put operation fails.
-func (fc *fileCache) put(key string, fetchCb fileCacheFetchCb) error {
-	defer fc.save()
-	fc.logger.Info("file cache put", "key", key)
+func (fc *fileCache) put(key string, fetchCb fileCacheFetchCb, validator string) error {
+	fc.logger.Info("file cache put", "key", key, "backend", fc.backend)
+	backend, err := getFileCacheBackend(fc.backend)
+	if err != nil {
+		return err
+	}
 	return CreateTempDir(fc.ctx, func(tempDir string) error {
 		src := filepath.Join(tempDir, "path")
 		err := fetchCb(src)
@@ -208,6 +464,50 @@ func (fc *fileCache) put(key string, fetchCb fileCacheFetchCb) error {
 			return err
 		}
 		isFile := !lstat.IsDir()
+		// blobs are unique per put (unless content-addressed) - the existing item's blob remains intact until the new blob is committed
+		blobId := fmt.Sprintf("key-%s-%s", key, uuid.NewString())
+		if fc.contentAddressed {
+			blobId, err = hashPath(fc.ctx, src)
+			if err != nil {
+				return err
+			}
+		}
+		return fc.locked(func() error {
+			defer fc.save()
+			return fc.commit(key, src, blobId, isFile, validator, backend)
+		})
+	})
+}
+
+// Commits fetched data (at src) to the cache as the given blob - replacing any existing item with the same key.
+// The existing item's blob is only released once the new blob is stored and recorded - a failed commit leaves the existing item intact.
+// Must be called while holding the file cache lock.
+// Returns an error if the commit fails.
+func (fc *fileCache) commit(key string, src string, blobId string, isFile bool, validator string, backend fileCacheBackend) error {
+	item := fileCacheItem{
+		Blob:         blobId,
+		Key:          key,
+		LastAccessed: time.Now(),
+		LastUuid:     fc.uuid,
+		StoredAt:     time.Now(),
+		Validator:    validator,
+	}
+	existing, ok := fc.contents[key]
+	if ok && fc.contentAddressed && existing.Blob == blobId {
+		fc.contents[key] = item
+		return nil
+	}
+	if ok {
+		// the existing item is served should the commit fail - protect it from being trimmed
+		existing.LastUuid = fc.uuid
+		fc.contents[key] = existing
+	}
+	blob, ok := fc.blobs[blobId]
+	if ok {
+		fc.logger.Info("file cache blob exists", "key", key, "blob", blobId)
+		blob.RefCount += 1
+		fc.blobs[blobId] = blob
+	} else {
 		sizeHint, err := GetPathSize(fc.ctx, src)
 		if err != nil {
 			return err
@@ -217,29 +517,42 @@ func (fc *fileCache) put(key string, fetchCb fileCacheFetchCb) error {
 		if err != nil {
 			return err
 		}
-		cachedSrc := filepath.Join(fc.dir, fmt.Sprintf("%s.squashfs", key))
-		_, err = Command(fc.ctx, []string{"mksquashfs", src, cachedSrc, "-no-xattrs"}, CmdOpts{}).Run()
+		cachedSrc := filepath.Join(fc.dir, fmt.Sprintf("%s.%s", blobId, backend.extension()))
+		// blobs are stored under a temporary name and renamed once complete - interrupted writes never leave a partial blob behind
+		tmp := filepath.Join(fc.dir, fmt.Sprintf(".%s.tmp", filepath.Base(cachedSrc)))
+		defer os.Remove(tmp)
+		err = backend.put(fc.ctx, src, tmp)
 		if err != nil {
 			return err
 		}
-		err = fc.trim(0)
+		err = os.Rename(tmp, cachedSrc)
 		if err != nil {
 			return err
 		}
-		lstat, err = os.Lstat(cachedSrc)
+		lstat, err := os.Lstat(cachedSrc)
 		if err != nil {
 			return err
 		}
-		fc.contents[key] = fileCacheItem{
-			IsFile:       isFile,
-			Key:          key,
-			LastAccessed: time.Now(),
-			LastUuid:     fc.uuid,
-			Path:         cachedSrc,
-			Size:         int(lstat.Size()),
+		digest, err := hashFile(cachedSrc, sha256.New)
+		if err != nil {
+			return err
 		}
-		return nil
-	})
+		fc.blobs[blobId] = fileCacheBlob{
+			Backend:  fc.backend,
+			Checksum: fmt.Sprintf("sha256:%s", digest),
+			Id:       blobId,
+			IsFile:   isFile,
+			Path:     cachedSrc,
+			RefCount: 1,
+			Size:     int(lstat.Size()),
+		}
+	}
+	_, err := fc.unref(key)
+	fc.contents[key] = item
+	if err != nil {
+		return err
+	}
+	return fc.trim(0)
 }
 
 // Sorting function that puts cache items with a current uuid at the end of the list, otherwise sorts by access times.
@@ -256,11 +569,11 @@ func (fc *fileCache) itemSortFunc(a fileCacheItem, b fileCacheItem) int {
 	return int(a.LastAccessed.Sub(b.LastAccessed).Seconds())
 }
 
-// Returns the current cache size by summing the sizes of the cache's contents.
+// Returns the current cache size by summing the sizes of the cache's blobs.
 func (fc *fileCache) getCacheSize() int {
 	size := 0
-	for _, item := range fc.contents {
-		size += item.Size
+	for _, blob := range fc.blobs {
+		size += blob.Size
 	}
 	return size
 }
@@ -289,11 +602,11 @@ func (fc *fileCache) trim(offset int) error {
 			fc.logger.Info("stop iteration - current uuid found", "key", item.Key)
 			break
 		}
-		err := fc.pop(item.Key)
+		freed, err := fc.pop(item.Key)
 		if err != nil {
 			return err
 		}
-		currentSize -= item.Size
+		currentSize -= freed
 	}
 	if currentSize >= desiredSize {
 		return fmt.Errorf("trim failed - %d > %d", currentSize, desiredSize)
@@ -301,11 +614,126 @@ func (fc *fileCache) trim(offset int) error {
 	return nil
 }
 
+// Evicts the least recently used items until the cache is no larger than maxSize bytes.
+// Unlike [fileCache.trim], items accessed during the current session are also eligible for eviction.
+// Returns the evicted keys.
+// Returns an error if an item cannot be evicted.
+func (fc *fileCache) prune(maxSize int) ([]string, error) {
+	items := fc.contents.Values()
+	slices.SortFunc(items, fc.itemSortFunc)
+	evicted := []string{}
+	currentSize := fc.getCacheSize()
+	for currentSize > maxSize && len(items) > 0 {
+		item := items[0]
+		items = items[1:]
+		freed, err := fc.pop(item.Key)
+		if err != nil {
+			return evicted, err
+		}
+		evicted = append(evicted, item.Key)
+		currentSize -= freed
+	}
+	return evicted, nil
+}
+
+// Verifies the on-disk cache against its manifest - without modifying either.
+// Reports items referencing unknown blobs, missing, resized or corrupt (checksum mismatch) blobs, incorrect reference counts and untracked paths.
+// Returns an error if the cache directory cannot be read.
+func (fc *fileCache) verify() ([]fileCacheProblem, error) {
+	problems := []fileCacheProblem{}
+	refCounts := Map[string, int]{}
+	keys := fc.contents.Keys()
+	slices.Sort(keys)
+	for _, key := range keys {
+		item := fc.contents[key]
+		_, ok := fc.blobs[item.Blob]
+		if !ok {
+			problems = append(problems, fileCacheProblem{Blob: item.Blob, Key: key, Problem: "blob not found"})
+			continue
+		}
+		refCounts[item.Blob] += 1
+	}
+	validPaths := map[string]bool{}
+	ids := fc.blobs.Keys()
+	slices.Sort(ids)
+	for _, id := range ids {
+		blob := fc.blobs[id]
+		validPaths[blob.Path] = true
+		_, err := getFileCacheBackend(blob.Backend)
+		if err != nil {
+			problems = append(problems, fileCacheProblem{Blob: id, Problem: err.Error()})
+		}
+		if blob.RefCount != refCounts[id] {
+			problems = append(problems, fileCacheProblem{Blob: id, Problem: fmt.Sprintf("reference count %d != %d", blob.RefCount, refCounts[id])})
+		}
+		lstat, err := os.Lstat(blob.Path)
+		if errors.Is(err, os.ErrNotExist) {
+			problems = append(problems, fileCacheProblem{Blob: id, Problem: "blob path not found"})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if int(lstat.Size()) != blob.Size {
+			problems = append(problems, fileCacheProblem{Blob: id, Problem: fmt.Sprintf("size %d != %d", lstat.Size(), blob.Size)})
+			continue
+		}
+		err = fc.verifyBlob(blob)
+		if errors.Is(err, errFileCacheCorrupt) {
+			problems = append(problems, fileCacheProblem{Blob: id, Problem: err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	subpaths, err := ListDir(fc.ctx, fc.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, subpath := range subpaths {
+		if subpath == fc.getManifestPath() || subpath == fc.getLockPath() || validPaths[subpath] {
+			continue
+		}
+		problems = append(problems, fileCacheProblem{Problem: fmt.Sprintf("untracked path %s", subpath)})
+	}
+	return problems, nil
+}
+
 // Persists the current file cache metadata to the on-disk manifest.
+// The manifest is written atomically - a crash mid-write never leaves a truncated manifest behind.
 // Returns an error if the file save operation fails.
 func (fc *fileCache) save() error {
-	data := fileCacheManifest{Contents: fc.contents, Version: fileCacheVersion}
-	return MarshalFile(fc.ctx, data, fc.getManifestPath())
+	SetGauge(fc.ctx, "gsh_file_cache_size_bytes", "Size of the file cache", float64(fc.getCacheSize()), nil)
+	data, err := json.Marshal(fileCacheManifest{Blobs: fc.blobs, Contents: fc.contents, Version: fileCacheVersion})
+	if err != nil {
+		return err
+	}
+	// the manifest is written atomically - other processes (and interrupted writes) never observe a partial manifest
+	return writeFileAtomic(fc.getManifestPath(), data, 0644)
+}
+
+// Parses the file cache verification setting into the fraction (0-1) of retrievals that verify blob checksums.
+// Accepts 'always', 'never' (the default when empty), or a sample rate (e.g., '0.1').
+// Checksums are recorded when blobs are stored - by default, retrievals only detect truncated or undecodable blobs and full verification is left to 'cache verify' (e.g., run on a schedule).
+// Returns an error if the setting is unrecognized.
+func parseFileCacheVerify(value string) (float64, error) {
+	switch value {
+	case "always":
+		return 1, nil
+	case "", "never":
+		return 0, nil
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("file cache verify must be 'always', 'never' or a sample rate between 0 and 1 (got %s)", value)
+	}
+	return rate, nil
+}
+
+// Creates a [fileCache] for the given cache directory, configured from the context
+func newFileCache(ctx context.Context, dir string) fileCache {
+	return fileCache{backend: FileCacheBackend(ctx), contentAddressed: FileCacheContentAddressed(ctx), ctx: ctx, dir: dir, logger: Logger(ctx), sizeLimit: FileCacheSizeLimit(ctx) * int(math.Pow10(6)), uuid: Uuid(ctx), verifyRate: FileCacheVerifyRate(ctx)}
 }
 
 // Performs a passthrough (i.e., fetches a path to dest)
@@ -323,10 +751,18 @@ func fileCachePassthrough(ctx context.Context, dest string, fetchCb fileCacheFet
 }
 
 // Caches a function by key on-disk.
-// If the key does not exist, the fetch callback is called
+// If the key does not exist (or is stale - see: [CacheFileOpts]), the fetch callback is called
 // If the key does exist, the data is fetched from cache.
+// If refreshing a stale key fails, the stale data is fetched from cache.
+// The cache directory is locked while the cache is read or updated - but not while the fetch callback runs (concurrent callers missing the same key may each fetch it).
+// Cached data that cannot be decoded (or that fails checksum verification - see: [FileCacheVerifyRate]) is evicted and re-fetched via the fetch callback.
+// Revalidation is configured by (at most one) [CacheFileOpts] - without options, cached items never expire.
 // Returns an error if any file cache operation fails.
-func CacheFile(ctx context.Context, key string, dest string, fetchCb fileCacheFetchCb) error {
+func CacheFile(ctx context.Context, key string, dest string, fetchCb fileCacheFetchCb, opts ...CacheFileOpts) error {
+	cacheOpts := CacheFileOpts{}
+	if len(opts) > 0 {
+		cacheOpts = opts[0]
+	}
 	if !FileCacheEnabled(ctx) {
 		Logger(ctx).Info("cache disabled")
 		return fileCachePassthrough(ctx, dest, fetchCb)
@@ -336,16 +772,75 @@ func CacheFile(ctx context.Context, key string, dest string, fetchCb fileCacheFe
 		Logger(ctx).Info("cache directory unset")
 		return fileCachePassthrough(ctx, dest, fetchCb)
 	}
-	fc := fileCache{ctx: ctx, dir: cacheDir, logger: Logger(ctx), sizeLimit: FileCacheSizeLimit(ctx) * int(math.Pow10(6)), uuid: Uuid(ctx)}
-	err := fc.initialize()
+	fc := newFileCache(ctx, cacheDir)
+	item := fileCacheItem{}
+	cached := false
+	err := fc.locked(func() error {
+		item, cached = fc.contents[key]
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	if !fc.hasKey(key) {
-		err := fc.put(key, fetchCb)
+	fresh := false
+	revalidated := false
+	validator := ""
+	if cached {
+		fresh, validator, revalidated = fc.isFresh(item, cacheOpts)
+	} else if cacheOpts.Validate != nil {
+		validator, err = cacheOpts.Validate("")
+		if err != nil {
+			fc.logger.Warn("cache item validator unavailable", "key", key, "error", err.Error())
+			validator = ""
+		}
+	}
+	if fresh {
+		AddCounter(ctx, "gsh_file_cache_hits_total", "Number of file cache lookups served from the cache", 1, nil)
+	} else if cached {
+		AddCounter(ctx, "gsh_file_cache_refreshes_total", "Number of file cache lookups refreshing a stale item", 1, nil)
+		err := fc.put(key, fetchCb, validator)
 		if err != nil {
+			fc.logger.Warn("cache item refresh failed - serving stale item", "key", key, "error", err.Error())
+		}
+	} else {
+		AddCounter(ctx, "gsh_file_cache_misses_total", "Number of file cache lookups requiring a fetch", 1, nil)
+		err := fc.put(key, fetchCb, validator)
+		if err != nil {
+			return err
+		}
+	}
+	getCorrupt := func() error {
+		err := fc.get(key, dest)
+		if !errors.Is(err, errFileCacheCorrupt) {
 			return err
 		}
+		fc.logger.Warn("file cache blob corrupt - evicting", "key", key, "error", err.Error())
+		AddCounter(ctx, "gsh_file_cache_corruptions_total", "Number of corrupt file cache blobs detected", 1, nil)
+		evictErr := fc.evictBlob(fc.contents[key].Blob)
+		if evictErr != nil {
+			return evictErr
+		}
+		return err
 	}
-	return fc.get(key, dest)
+	err = fc.locked(func() error {
+		if revalidated {
+			fc.renew(item)
+		}
+		return getCorrupt()
+	})
+	if !errors.Is(err, errFileCacheCorrupt) {
+		return err
+	}
+	fc.logger.Info("re-fetch corrupt cache item", "key", key)
+	err = RemovePaths(ctx, dest)
+	if err != nil {
+		return err
+	}
+	err = fc.put(key, fetchCb, validator)
+	if err != nil {
+		return err
+	}
+	return fc.locked(func() error {
+		return fc.get(key, dest)
+	})
 }
@@ -0,0 +1,424 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Creates a context with the file cache enabled (using a temporary cache directory)
+func newTestCacheContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx := newTestContext(t)
+	ctx = context.WithValue(ctx, ctxKeyDirs{}, Map[string, string]{"cache": filepath.Join(t.TempDir(), "cache")})
+	ctx = context.WithValue(ctx, ctxKeyFileCacheBackend{}, fileCacheBackendDefault)
+	ctx = context.WithValue(ctx, ctxKeyFileCacheContentAddressed{}, false)
+	ctx = context.WithValue(ctx, ctxKeyFileCacheEnabled{}, true)
+	ctx = context.WithValue(ctx, ctxKeyFileCacheSizeLimit{}, 0)
+	ctx = context.WithValue(ctx, ctxKeyFileCacheVerifyRate{}, 1.0)
+	ctx = context.WithValue(ctx, ctxKeyUuid{}, "test")
+	return ctx
+}
+
+// Returns a fetch callback that writes content to the fetched path
+func writeTestFetchCb(content string) fileCacheFetchCb {
+	return func(path string) error {
+		return os.WriteFile(path, []byte(content), 0644)
+	}
+}
+
+func TestCacheFileConcurrent(t *testing.T) {
+	ctx := newTestCacheContext(t)
+	dir := t.TempDir()
+
+	wg := sync.WaitGroup{}
+	errs := make(chan error, 16)
+	for index := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := fmt.Sprintf("key-%d", index%4)
+			dest := filepath.Join(dir, fmt.Sprintf("dest-%d", index))
+			err := CacheFile(ctx, key, dest, writeTestFetchCb(key), CacheFileOpts{})
+			if err == nil {
+				var data []byte
+				data, err = os.ReadFile(dest)
+				if err == nil && string(data) != key {
+					err = fmt.Errorf("%s contains %q (expected %q)", dest, data, key)
+				}
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fc := newFileCache(ctx, Dirs(ctx)["cache"])
+	err := fc.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems, err := fc.verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("cache inconsistent: %+v", problems)
+	}
+	if len(fc.contents) != 4 {
+		t.Fatalf("cache holds %d keys (expected 4)", len(fc.contents))
+	}
+}
+
+func TestCacheFileFetchUnlocked(t *testing.T) {
+	ctx := newTestCacheContext(t)
+	dir := t.TempDir()
+
+	// the slow fetch only completes once another key has been cached - which deadlocks if the lock is held during fetches
+	cached := make(chan bool)
+	slowFetch := func(path string) error {
+		select {
+		case <-cached:
+		case <-time.After(5 * time.Second):
+			return fmt.Errorf("file cache locked during fetch")
+		}
+		return os.WriteFile(path, []byte("slow"), 0644)
+	}
+
+	slowErr := make(chan error, 1)
+	started := make(chan bool)
+	go func() {
+		close(started)
+		slowErr <- CacheFile(ctx, "slow", filepath.Join(dir, "slow"), slowFetch, CacheFileOpts{})
+	}()
+	<-started
+	time.Sleep(100 * time.Millisecond)
+
+	err := CacheFile(ctx, "fast", filepath.Join(dir, "fast"), writeTestFetchCb("fast"), CacheFileOpts{})
+	close(cached)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = <-slowErr
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheFileSymlinkedDest(t *testing.T) {
+	ctx := newTestCacheContext(t)
+	root := t.TempDir()
+	err := os.Mkdir(filepath.Join(root, "real"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(filepath.Join(root, "real"), filepath.Join(root, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = CacheFile(ctx, "key", filepath.Join(root, "link", "file"), writeTestFetchCb("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "real", "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "data" {
+		t.Fatalf("restored %q (expected %q)", data, "data")
+	}
+}
+
+func TestCacheFileCorruptBlob(t *testing.T) {
+	ctx := newTestCacheContext(t)
+	ctx = context.WithValue(ctx, ctxKeyFileCacheVerifyRate{}, 0.0)
+	dir := t.TempDir()
+	fetches := 0
+	fetchCb := func(path string) error {
+		fetches += 1
+		return os.WriteFile(path, []byte("data"), 0644)
+	}
+
+	err := CacheFile(ctx, "key", filepath.Join(dir, "first"), fetchCb, CacheFileOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc := newFileCache(ctx, Dirs(ctx)["cache"])
+	err = fc.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := fc.blobs[fc.contents["key"].Blob]
+	// garbage of the same size passes the size check performed when the cache is loaded
+	err = os.WriteFile(blob.Path, bytes.Repeat([]byte{0xff}, blob.Size), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = CacheFile(ctx, "key", filepath.Join(dir, "second"), fetchCb, CacheFileOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetches != 2 {
+		t.Fatalf("fetched %d times (expected corrupt blob to be re-fetched)", fetches)
+	}
+}
+
+func TestCacheFileRestoreFailureNotCorrupt(t *testing.T) {
+	ctx := newTestCacheContext(t)
+	dir := t.TempDir()
+	fetches := 0
+	fetchCb := func(path string) error {
+		fetches += 1
+		return os.WriteFile(path, []byte("data"), 0644)
+	}
+
+	err := CacheFile(ctx, "key", filepath.Join(dir, "first"), fetchCb, CacheFileOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// restoring beneath a regular file fails - without implicating the cached blob
+	err = CacheFile(ctx, "key", filepath.Join(dir, "first", "second"), fetchCb, CacheFileOpts{})
+	if err == nil {
+		t.Fatal("expected restore to fail")
+	}
+	if errors.Is(err, errFileCacheCorrupt) || fetches != 1 {
+		t.Fatalf("restore failure treated as corruption (fetches: %d, error: %v)", fetches, err)
+	}
+}
+
+// Returns a fetch callback that writes the current value of content (counting fetches)
+func countTestFetchCb(content *string, fetches *int) fileCacheFetchCb {
+	return func(path string) error {
+		*fetches += 1
+		return os.WriteFile(path, []byte(*content), 0644)
+	}
+}
+
+// Asserts that a file holds the expected content
+func assertTestFileContent(t *testing.T, path string, expected string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Fatalf("%s holds %q (expected %q)", path, data, expected)
+	}
+}
+
+func TestCacheFileTTL(t *testing.T) {
+	ctx := newTestCacheContext(t)
+	dir := t.TempDir()
+	content := "v1"
+	fetches := 0
+	opts := CacheFileOpts{TTL: 200 * time.Millisecond}
+
+	for index, expected := range []string{"v1", "v1"} {
+		dest := filepath.Join(dir, fmt.Sprintf("dest-%d", index))
+		err := CacheFile(ctx, "key", dest, countTestFetchCb(&content, &fetches), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertTestFileContent(t, dest, expected)
+		content = "v2"
+	}
+	if fetches != 1 {
+		t.Fatalf("fetched %d times before expiry (expected 1)", fetches)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	dest := filepath.Join(dir, "expired")
+	err := CacheFile(ctx, "key", dest, countTestFetchCb(&content, &fetches), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTestFileContent(t, dest, "v2")
+	if fetches != 2 {
+		t.Fatalf("fetched %d times (expected expired item to be re-fetched)", fetches)
+	}
+}
+
+func TestCacheFileValidate(t *testing.T) {
+	ctx := newTestCacheContext(t)
+	dir := t.TempDir()
+	content := "v1"
+	fetches := 0
+	version := "1"
+	var versionErr error
+	opts := CacheFileOpts{Validate: func(validator string) (string, error) {
+		return version, versionErr
+	}}
+
+	tests := []struct {
+		name     string
+		version  string
+		err      error
+		content  string
+		expected string
+		fetches  int
+	}{
+		{name: "miss", version: "1", content: "v1", expected: "v1", fetches: 1},
+		{name: "unchanged", version: "1", content: "v2", expected: "v1", fetches: 1},
+		{name: "changed", version: "2", content: "v2", expected: "v2", fetches: 2},
+		{name: "unavailable serves stale", version: "3", err: fmt.Errorf("upstream unavailable"), content: "v3", expected: "v2", fetches: 2},
+	}
+	for _, test := range tests {
+		version = test.version
+		versionErr = test.err
+		content = test.content
+		dest := filepath.Join(dir, test.name)
+		err := CacheFile(ctx, "key", dest, countTestFetchCb(&content, &fetches), opts)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		assertTestFileContent(t, dest, test.expected)
+		if fetches != test.fetches {
+			t.Fatalf("%s: fetched %d times (expected %d)", test.name, fetches, test.fetches)
+		}
+	}
+}
+
+func TestCacheFileRefreshFailureServesStale(t *testing.T) {
+	ctx := newTestCacheContext(t)
+	ctx = context.WithValue(ctx, ctxKeyFileCacheSizeLimit{}, 1)
+	dir := t.TempDir()
+	opts := CacheFileOpts{TTL: time.Millisecond}
+
+	err := CacheFile(ctx, "key", filepath.Join(dir, "first"), writeTestFetchCb("stale"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	failures := Map[string, fileCacheFetchCb]{
+		// the fetch itself fails
+		"fetch": func(path string) error {
+			return fmt.Errorf("upstream unavailable")
+		},
+		// the fetch succeeds but exceeds the cache's size limit - failing the commit
+		"commit": func(path string) error {
+			data := make([]byte, 2*1000*1000)
+			rand.Read(data)
+			return os.WriteFile(path, data, 0644)
+		},
+	}
+	for name, fetchCb := range failures {
+		dest := filepath.Join(dir, name)
+		err = CacheFile(ctx, "key", dest, fetchCb, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		assertTestFileContent(t, dest, "stale")
+	}
+}
+
+// Loads the on-disk state of the file cache
+func loadTestFileCache(t *testing.T, ctx context.Context) fileCache {
+	t.Helper()
+	fc := newFileCache(ctx, Dirs(ctx)["cache"])
+	err := fc.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fc
+}
+
+// Returns a fetch callback that writes size bytes of incompressible data
+func randomTestFetchCb(size int) fileCacheFetchCb {
+	return func(path string) error {
+		data := make([]byte, size)
+		rand.Read(data)
+		return os.WriteFile(path, data, 0644)
+	}
+}
+
+func TestCacheFileContentAddressed(t *testing.T) {
+	ctx := newTestCacheContext(t)
+	ctx = context.WithValue(ctx, ctxKeyFileCacheContentAddressed{}, true)
+	dir := t.TempDir()
+
+	for _, key := range []string{"a", "b", "c"} {
+		content := "shared"
+		if key == "c" {
+			content = "unique"
+		}
+		err := CacheFile(ctx, key, filepath.Join(dir, key), writeTestFetchCb(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertTestFileContent(t, filepath.Join(dir, key), content)
+	}
+	fc := loadTestFileCache(t, ctx)
+	if len(fc.blobs) != 2 {
+		t.Fatalf("cache holds %d blobs (expected identical content to be deduplicated)", len(fc.blobs))
+	}
+	shared := fc.blobs[fc.contents["a"].Blob]
+	if fc.contents["b"].Blob != shared.Id || shared.RefCount != 2 {
+		t.Fatalf("unexpected shared blob %+v", shared)
+	}
+
+	// popping a key only removes its blob once no other key references it
+	freed, err := fc.pop("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed != 0 || fc.blobs[shared.Id].RefCount != 1 {
+		t.Fatalf("popping a shared blob freed %d bytes (refcount: %d)", freed, fc.blobs[shared.Id].RefCount)
+	}
+	freed, err = fc.pop("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed != shared.Size {
+		t.Fatalf("popping the last reference freed %d bytes (expected %d)", freed, shared.Size)
+	}
+	_, err = os.Stat(shared.Path)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("unreferenced blob left behind (error: %v)", err)
+	}
+}
+
+func TestCacheFileTrim(t *testing.T) {
+	ctx := newTestCacheContext(t)
+	ctx = context.WithValue(ctx, ctxKeyFileCacheSizeLimit{}, 1)
+	dir := t.TempDir()
+
+	previous := context.WithValue(ctx, ctxKeyUuid{}, "previous")
+	err := CacheFile(previous, "old", filepath.Join(dir, "old"), randomTestFetchCb(600*1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// items accessed during the current session are never trimmed - the previous session's item makes room
+	err = CacheFile(ctx, "new", filepath.Join(dir, "new"), randomTestFetchCb(600*1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc := loadTestFileCache(t, ctx)
+	if fc.hasKey("old") || !fc.hasKey("new") {
+		t.Fatalf("unexpected keys %v (expected old to be trimmed)", fc.contents.Keys())
+	}
+
+	// the cache cannot make room without trimming the current session's items
+	err = CacheFile(ctx, "newer", filepath.Join(dir, "newer"), randomTestFetchCb(600*1000))
+	if err == nil {
+		t.Fatal("expected trim to fail")
+	}
+	fc = loadTestFileCache(t, ctx)
+	if !fc.hasKey("new") || fc.hasKey("newer") {
+		t.Fatalf("unexpected keys %v", fc.contents.Keys())
+	}
+}
@@ -0,0 +1,159 @@
+package helper
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// fileCacheBackend stores paths within (and restores paths from) the file cache
+type fileCacheBackend interface {
+	// Returns the file extension used by items stored with this backend
+	extension() string
+	// Restores the item stored at path to dest - failures decoding the stored item are wrapped with [errFileCacheCorrupt]
+	get(ctx context.Context, path string, dest string, isFile bool) error
+	// Stores the src path as an item at path
+	put(ctx context.Context, src string, path string) error
+}
+
+// fileCacheBackends are the available file cache storage backends (by name)
+var fileCacheBackends = map[string]fileCacheBackend{
+	"squashfs": fileCacheBackendSquashfs{},
+	"tar.zst":  fileCacheBackendTarZstd{},
+}
+
+// fileCacheBackendDefault is the name of the default file cache storage backend
+const fileCacheBackendDefault = "tar.zst"
+
+// Looks up a file cache backend by name.
+// Returns an error if the backend is unrecognized.
+func getFileCacheBackend(name string) (fileCacheBackend, error) {
+	backend, ok := fileCacheBackends[name]
+	if !ok {
+		return nil, fmt.Errorf("unrecognized file cache backend %s", name)
+	}
+	return backend, nil
+}
+
+// Moves a path into place by renaming it over dest (replacing any existing path).
+// Returns an error if the rename fails.
+func replacePath(ctx context.Context, src string, dest string) error {
+	err := RemovePaths(ctx, dest)
+	if err != nil {
+		return err
+	}
+	return os.Rename(src, dest)
+}
+
+// fileCacheBackendSquashfs stores items as squashfs images - requires 'mksquashfs' and 'unsquashfs'
+type fileCacheBackendSquashfs struct{}
+
+// Returns the file extension used by squashfs images
+func (b fileCacheBackendSquashfs) extension() string {
+	return "squashfs"
+}
+
+// Restores a squashfs image to dest.
+// Failures are not classified as corruption ('unsquashfs' failures cannot be distinguished from failures writing dest) - corrupt images are detected via checksum verification (see: [FileCacheVerifyRate]).
+// Single files are extracted into a temporary directory alongside dest and then moved into place.
+// Returns an error if 'unsquashfs' fails.
+func (b fileCacheBackendSquashfs) get(ctx context.Context, path string, dest string, isFile bool) error {
+	if !isFile {
+		_, err := Command(ctx, []string{"unsquashfs", "-force", "-no-xattrs", "-dest", dest, path}, CmdOpts{}).Run()
+		return err
+	}
+	tempDir, err := os.MkdirTemp(filepath.Dir(dest), ".unsquashfs-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+	root := filepath.Join(tempDir, "root")
+	_, err = Command(ctx, []string{"unsquashfs", "-force", "-no-xattrs", "-dest", root, path}, CmdOpts{}).Run()
+	if err != nil {
+		return err
+	}
+	return replacePath(ctx, filepath.Join(root, "path"), dest)
+}
+
+// Stores src as a squashfs image.
+// Returns an error if 'mksquashfs' fails.
+func (b fileCacheBackendSquashfs) put(ctx context.Context, src string, path string) error {
+	_, err := Command(ctx, []string{"mksquashfs", src, path, "-no-xattrs"}, CmdOpts{}).Run()
+	return err
+}
+
+// fileCacheBackendTarZstd stores items as zstd compressed tar archives - implemented natively
+type fileCacheBackendTarZstd struct{}
+
+// Returns the file extension used by zstd compressed tar archives
+func (b fileCacheBackendTarZstd) extension() string {
+	return "tar.zst"
+}
+
+// fileCacheDecodeReader wraps the decoded stream of a stored item - marking read failures (e.g., zstd decoding errors) as corruption (see: [errFileCacheCorrupt])
+type fileCacheDecodeReader struct {
+	reader io.Reader
+}
+
+// Reads from the decoded stream - wrapping failures with [errFileCacheCorrupt]
+func (r fileCacheDecodeReader) Read(data []byte) (int, error) {
+	count, err := r.reader.Read(data)
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = fmt.Errorf("%w: %w", errFileCacheCorrupt, err)
+	}
+	return count, err
+}
+
+// Marks archive decoding failures (e.g., malformed or truncated tar streams) as corruption (see: [errFileCacheCorrupt]).
+// Other failures (e.g., failures writing to the destination) are returned unchanged.
+func fileCacheDecodeError(err error) error {
+	if err == nil || errors.Is(err, errFileCacheCorrupt) {
+		return err
+	}
+	if errors.Is(err, tar.ErrHeader) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %w", errFileCacheCorrupt, err)
+	}
+	return err
+}
+
+// Restores a zstd compressed tar archive to dest.
+// Returns an error wrapping [errFileCacheCorrupt] if the archive cannot be decoded.
+// Returns an error if the archive cannot be extracted.
+func (b fileCacheBackendTarZstd) get(ctx context.Context, path string, dest string, isFile bool) error {
+	reader, err := openTarArchive(path, archiveFormatTarZstd)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	decoded := fileCacheDecodeReader{reader: reader}
+	if !isFile {
+		e, err := newExtractor(ctx, dest)
+		if err != nil {
+			return err
+		}
+		return fileCacheDecodeError(e.tar(decoded))
+	}
+	tarReader := tar.NewReader(decoded)
+	header, err := tarReader.Next()
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: archive empty", errFileCacheCorrupt)
+	}
+	if err != nil {
+		return fileCacheDecodeError(err)
+	}
+	e, err := newExtractor(ctx, filepath.Dir(dest))
+	if err != nil {
+		return err
+	}
+	return fileCacheDecodeError(e.file(filepath.Join(e.dest, filepath.Base(dest)), header.FileInfo().Mode(), header.ModTime, tarReader))
+}
+
+// Stores src as a zstd compressed tar archive.
+// Returns an error if the archive cannot be created.
+func (b fileCacheBackendTarZstd) put(ctx context.Context, src string, path string) error {
+	return createTarZstd(ctx, src, path)
+}
@@ -0,0 +1,272 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// fileCacheEntry describes a cache key (and the blob it references) as reported by the 'cache' subcommands
+type fileCacheEntry struct {
+	Backend      string    `json:"backend"`
+	Blob         string    `json:"blob"`
+	IsFile       bool      `json:"isFile"`
+	Key          string    `json:"key"`
+	LastAccessed time.Time `json:"lastAccessed"`
+	LastUuid     string    `json:"lastUuid"`
+	Path         string    `json:"path"`
+	RefCount     int       `json:"refCount"`
+	Size         int       `json:"size"`
+	StoredAt     time.Time `json:"storedAt"`
+	Validator    string    `json:"validator"`
+}
+
+// fileCacheProblem is an inconsistency between the cache manifest and the cache directory found by 'cache verify'
+type fileCacheProblem struct {
+	Blob    string `json:"blob,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Problem string `json:"problem"`
+}
+
+// fileCachePruneResult is the result of a 'cache evict' or 'cache prune' subcommand
+type fileCachePruneResult struct {
+	Evicted []string `json:"evicted"`
+	Size    int      `json:"size"`
+}
+
+// Returns a description of a key (and the blob it references) within the file cache
+func (fc *fileCache) entry(key string) (fileCacheEntry, bool) {
+	item, ok := fc.contents[key]
+	if !ok {
+		return fileCacheEntry{}, false
+	}
+	blob := fc.blobs[item.Blob]
+	return fileCacheEntry{
+		Backend:      blob.Backend,
+		Blob:         item.Blob,
+		IsFile:       blob.IsFile,
+		Key:          key,
+		LastAccessed: item.LastAccessed,
+		LastUuid:     item.LastUuid,
+		Path:         blob.Path,
+		RefCount:     blob.RefCount,
+		Size:         blob.Size,
+		StoredAt:     item.StoredAt,
+		Validator:    item.Validator,
+	}, true
+}
+
+// Returns descriptions of every key within the file cache (sorted by key)
+func (fc *fileCache) entries() []fileCacheEntry {
+	keys := fc.contents.Keys()
+	slices.Sort(keys)
+	entries := []fileCacheEntry{}
+	for _, key := range keys {
+		entry, _ := fc.entry(key)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Formats a size in bytes using (decimal) units - matching the units of the cache size limit
+func formatSize(size int) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	index := 0
+	for value >= 1000 && index < len(units)-1 {
+		value /= 1000
+		index += 1
+	}
+	if index == 0 {
+		return fmt.Sprintf("%d %s", size, units[index])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[index])
+}
+
+// Parses flags that may be interleaved with positional arguments (e.g., 'inspect <key> --json').
+// Returns the positional arguments.
+// Returns an error if flag parsing fails.
+func parseCacheArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		err := flags.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// Writes the output of a 'cache' subcommand - either as JSON or as a table (via the provided callback)
+func writeCacheOutput(writer io.Writer, asJson bool, data any, writeTable func(table *tabwriter.Writer)) error {
+	if asJson {
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(data)
+	}
+	table := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+	writeTable(table)
+	return table.Flush()
+}
+
+// Returns a callback that runs a file cache administration subcommand (composed of the provided arguments).
+//
+//	cache list [--json]
+//	cache inspect <key> [--json]
+//	cache evict <key> [--json]
+//	cache prune [--max-size <megabytes>] [--json]
+//	cache verify [--json]
+//
+// Prune defaults to the configured cache size limit (see: [FileCacheSizeLimit]) - when no limit is configured (i.e., the cache is unlimited), --max-size is required ('--max-size 0' empties the cache).
+// The cache directory is locked for the duration of the subcommand.
+func cacheCommand(args ...string) entrypointCb {
+	return func(ctx context.Context) error {
+		if len(args) == 0 {
+			return fmt.Errorf("cache subcommand unset")
+		}
+		subcommand := args[0]
+		if !slices.Contains([]string{"evict", "inspect", "list", "prune", "verify"}, subcommand) {
+			return fmt.Errorf("unknown cache subcommand %s", subcommand)
+		}
+		flags := flag.NewFlagSet(fmt.Sprintf("cache %s", subcommand), flag.ContinueOnError)
+		asJson := flags.Bool("json", false, "print output as JSON")
+		maxSize := -1
+		if subcommand == "prune" {
+			flags.IntVar(&maxSize, "max-size", FileCacheSizeLimit(ctx), "maximum cache size in megabytes")
+		}
+		positional, err := parseCacheArgs(flags, args[1:])
+		if err != nil {
+			return err
+		}
+		key := ""
+		switch subcommand {
+		case "evict", "inspect":
+			if len(positional) != 1 {
+				return fmt.Errorf("cache %s requires a single key", subcommand)
+			}
+			key = positional[0]
+		default:
+			if len(positional) != 0 {
+				return fmt.Errorf("cache %s accepts no arguments", subcommand)
+			}
+		}
+
+		cacheDir, ok := Dirs(ctx)["cache"]
+		if !ok {
+			return fmt.Errorf("cache directory unset")
+		}
+		fc := newFileCache(ctx, cacheDir)
+		unlock, err := fc.lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		// verification inspects the cache as-is - initialization would clean (and thus hide) inconsistencies
+		if subcommand == "verify" {
+			err = fc.load()
+		} else {
+			err = fc.initialize()
+		}
+		if err != nil {
+			return err
+		}
+
+		switch subcommand {
+		case "evict":
+			if !fc.hasKey(key) {
+				return fmt.Errorf("key not found %s", key)
+			}
+			_, err := fc.pop(key)
+			if err != nil {
+				return err
+			}
+			result := fileCachePruneResult{Evicted: []string{key}, Size: fc.getCacheSize()}
+			return writeCacheOutput(os.Stdout, *asJson, result, func(table *tabwriter.Writer) {
+				fmt.Fprintf(table, "evicted %s\n", key)
+			})
+		case "inspect":
+			entry, ok := fc.entry(key)
+			if !ok {
+				return fmt.Errorf("key not found %s", key)
+			}
+			return writeCacheOutput(os.Stdout, *asJson, entry, func(table *tabwriter.Writer) {
+				fmt.Fprintf(table, "Key:\t%s\n", entry.Key)
+				fmt.Fprintf(table, "Size:\t%s (%d bytes)\n", formatSize(entry.Size), entry.Size)
+				fmt.Fprintf(table, "Last Accessed:\t%s\n", entry.LastAccessed.Format(time.RFC3339))
+				fmt.Fprintf(table, "Last Uuid:\t%s\n", entry.LastUuid)
+				fmt.Fprintf(table, "Stored At:\t%s\n", entry.StoredAt.Format(time.RFC3339))
+				fmt.Fprintf(table, "Validator:\t%s\n", entry.Validator)
+				fmt.Fprintf(table, "Blob:\t%s\n", entry.Blob)
+				fmt.Fprintf(table, "Blob References:\t%d\n", entry.RefCount)
+				fmt.Fprintf(table, "Backend:\t%s\n", entry.Backend)
+				fmt.Fprintf(table, "Is File:\t%t\n", entry.IsFile)
+				fmt.Fprintf(table, "Path:\t%s\n", entry.Path)
+			})
+		case "list":
+			entries := fc.entries()
+			return writeCacheOutput(os.Stdout, *asJson, entries, func(table *tabwriter.Writer) {
+				fmt.Fprintln(table, "KEY\tSIZE\tLAST ACCESSED\tLAST UUID\tBLOB")
+				for _, entry := range entries {
+					fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", entry.Key, formatSize(entry.Size), entry.LastAccessed.Format(time.RFC3339), entry.LastUuid, entry.Blob)
+				}
+				fmt.Fprintf(table, "\ntotal: %s (%d keys, %d blobs)\n", formatSize(fc.getCacheSize()), len(fc.contents), len(fc.blobs))
+			})
+		case "prune":
+			if maxSize < 0 {
+				return fmt.Errorf("max size must not be negative")
+			}
+			explicit := false
+			flags.Visit(func(item *flag.Flag) {
+				explicit = explicit || item.Name == "max-size"
+			})
+			if maxSize == 0 && !explicit {
+				return fmt.Errorf("cache size unlimited - prune requires --max-size")
+			}
+			evicted, err := fc.prune(maxSize * int(math.Pow10(6)))
+			if err != nil {
+				return err
+			}
+			result := fileCachePruneResult{Evicted: evicted, Size: fc.getCacheSize()}
+			return writeCacheOutput(os.Stdout, *asJson, result, func(table *tabwriter.Writer) {
+				for _, key := range evicted {
+					fmt.Fprintf(table, "evicted %s\n", key)
+				}
+				fmt.Fprintf(table, "total: %s\n", formatSize(result.Size))
+			})
+		case "verify":
+			problems, err := fc.verify()
+			if err != nil {
+				return err
+			}
+			err = writeCacheOutput(os.Stdout, *asJson, problems, func(table *tabwriter.Writer) {
+				for _, problem := range problems {
+					fmt.Fprintf(table, "%s\t%s\t%s\n", problem.Key, problem.Blob, problem.Problem)
+				}
+				if len(problems) == 0 {
+					fmt.Fprintln(table, "ok")
+				}
+			})
+			if err != nil {
+				return err
+			}
+			if len(problems) > 0 {
+				return fmt.Errorf("file cache verification found %d problem(s)", len(problems))
+			}
+			return nil
+		default:
+			return fmt.Errorf("unknown cache subcommand %s", subcommand)
+		}
+	}
+}
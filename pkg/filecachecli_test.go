@@ -0,0 +1,151 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Runs a callback - returning everything it wrote to stdout
+func captureTestStdout(t *testing.T, callback func()) string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- string(data)
+	}()
+	defer func() {
+		os.Stdout = stdout
+	}()
+	callback()
+	writer.Close()
+	return <-output
+}
+
+// Runs a cache subcommand - returning its output and error
+func runTestCacheCommand(t *testing.T, ctx context.Context, args ...string) (string, error) {
+	t.Helper()
+	var err error
+	output := captureTestStdout(t, func() {
+		err = cacheCommand(args...)(ctx)
+	})
+	return output, err
+}
+
+func TestCacheCommand(t *testing.T) {
+	ctx := newTestCacheContext(t)
+	dir := t.TempDir()
+	for _, key := range []string{"a", "b"} {
+		err := CacheFile(ctx, key, filepath.Join(dir, key), writeTestFetchCb(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output, err := runTestCacheCommand(t, ctx, "list", "--json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []fileCacheEntry{}
+	err = json.Unmarshal([]byte(output), &entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Key != "a" || entries[1].Key != "b" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+
+	// flags may follow positional arguments
+	output, err = runTestCacheCommand(t, ctx, "inspect", "b", "--json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := fileCacheEntry{}
+	err = json.Unmarshal([]byte(output), &entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Key != "b" || entry.RefCount != 1 || entry.Size == 0 {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+
+	_, err = runTestCacheCommand(t, ctx, "inspect", "missing")
+	if err == nil {
+		t.Fatal("expected inspecting a missing key to fail")
+	}
+
+	output, err = runTestCacheCommand(t, ctx, "evict", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "evicted a") {
+		t.Fatalf("unexpected output %q", output)
+	}
+
+	_, err = runTestCacheCommand(t, ctx, "prune")
+	if err == nil || !strings.Contains(err.Error(), "--max-size") {
+		t.Fatalf("unexpected error %v (expected unlimited prune to require --max-size)", err)
+	}
+	output, err = runTestCacheCommand(t, ctx, "prune", "--max-size", "0", "--json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := fileCachePruneResult{}
+	err = json.Unmarshal([]byte(output), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Evicted) != 1 || result.Evicted[0] != "b" || result.Size != 0 {
+		t.Fatalf("unexpected prune result %+v", result)
+	}
+
+	_, err = runTestCacheCommand(t, ctx, "unknown")
+	if err == nil {
+		t.Fatal("expected unknown subcommand to fail")
+	}
+}
+
+func TestCacheCommandVerify(t *testing.T) {
+	ctx := newTestCacheContext(t)
+	err := CacheFile(ctx, "key", filepath.Join(t.TempDir(), "key"), writeTestFetchCb("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := runTestCacheCommand(t, ctx, "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(output) != "ok" {
+		t.Fatalf("unexpected output %q", output)
+	}
+
+	fc := loadTestFileCache(t, ctx)
+	blob := fc.blobs[fc.contents["key"].Blob]
+	err = os.Remove(blob.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err = runTestCacheCommand(t, ctx, "verify", "--json")
+	if err == nil {
+		t.Fatal("expected verification to fail")
+	}
+	problems := []fileCacheProblem{}
+	err = json.Unmarshal([]byte(output), &problems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) == 0 || problems[0].Blob != blob.Id {
+		t.Fatalf("unexpected problems %+v", problems)
+	}
+}
@@ -0,0 +1,106 @@
+package helper
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+)
+
+// fileCacheMigration upgrades a raw (i.e., JSON decoded) file cache manifest, in place, by a single version (including the manifest's version field)
+type fileCacheMigration func(fc *fileCache, manifest Map[string, any]) error
+
+// fileCacheMigrations upgrade a raw file cache manifest from a version (the key) to a later version.
+// When [fileCacheVersion] is incremented, a migration from the previous version must be added here.
+var fileCacheMigrations = map[string]fileCacheMigration{
+	"1": migrateFileCacheV1,
+}
+
+// Returns the manifest value at key as a (possibly empty) map.
+// Returns an error if the value exists but is not a map.
+func getManifestMap(manifest Map[string, any], key string) (Map[string, any], error) {
+	value, ok := manifest[key]
+	if !ok || value == nil {
+		return Map[string, any]{}, nil
+	}
+	data, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("manifest %s malformed", key)
+	}
+	return Map[string, any](data), nil
+}
+
+// Migrates a v1 manifest (where each item held its own squashfs image) to v2 (where items reference checksummed blobs and record when they were stored and their validator).
+// Blobs that cannot be read are left without a checksum - they are removed when the cache is cleaned.
+// The last access time is the best available estimate of when an item was stored.
+func migrateFileCacheV1(fc *fileCache, manifest Map[string, any]) error {
+	contents, err := getManifestMap(manifest, "contents")
+	if err != nil {
+		return err
+	}
+	blobs := map[string]any{}
+	for key, value := range contents {
+		item, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("manifest item %s malformed", key)
+		}
+		id := fmt.Sprintf("key-%s", key)
+		blob := map[string]any{
+			"backend":  "squashfs",
+			"id":       id,
+			"isFile":   item["isFile"],
+			"path":     item["path"],
+			"refCount": 1,
+			"size":     item["size"],
+		}
+		path, _ := item["path"].(string)
+		digest, err := hashFile(path, sha256.New)
+		if err == nil {
+			blob["checksum"] = fmt.Sprintf("sha256:%s", digest)
+		} else {
+			fc.logger.Info("cannot checksum cache blob", "blob", id, "error", err.Error())
+		}
+		blobs[id] = blob
+		contents[key] = map[string]any{
+			"blob":         id,
+			"key":          item["key"],
+			"lastAccessed": item["lastAccessed"],
+			"lastUuid":     item["lastUuid"],
+			"storedAt":     item["lastAccessed"],
+			"validator":    "",
+		}
+	}
+	manifest["blobs"] = blobs
+	manifest["version"] = "2"
+	return nil
+}
+
+// Upgrades a raw file cache manifest to the current [fileCacheVersion] by applying [fileCacheMigrations] in sequence.
+// Returns an error if the manifest version has no migration path.
+// Returns an error if a migration fails.
+func (fc *fileCache) migrate(manifest Map[string, any]) error {
+	for {
+		version, _ := manifest["version"].(string)
+		if version == fileCacheVersion {
+			return nil
+		}
+		migration, ok := fileCacheMigrations[version]
+		if !ok {
+			return fmt.Errorf("no migration from manifest version '%s'", version)
+		}
+		fc.logger.Info("migrate manifest", "from", version)
+		err := migration(fc, manifest)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Converts data from one type to another by round-tripping it through JSON.
+// Returns an error if the data cannot be JSON encoded or decoded.
+func remarshalJson(from any, to any) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, to)
+}
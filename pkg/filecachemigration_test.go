@@ -0,0 +1,43 @@
+package helper
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileCacheMigrateV1(t *testing.T) {
+	ctx := newTestCacheContext(t)
+	dir := Dirs(ctx)["cache"]
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobPath := filepath.Join(dir, "app.sqsh")
+	err = os.WriteFile(blobPath, []byte("data"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := fmt.Sprintf(`{"version": "1", "contents": {"app": {"isFile": false, "key": "app", "lastAccessed": "2024-01-02T03:04:05Z", "lastUuid": "previous", "path": %q, "size": 4}}}`, blobPath)
+	err = os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fc := newFileCache(ctx, dir)
+	err = fc.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, ok := fc.contents["app"]
+	if !ok || item.Blob != "key-app" || !item.StoredAt.Equal(item.LastAccessed) || item.LastUuid != "previous" {
+		t.Fatalf("unexpected item %+v", item)
+	}
+	blob, ok := fc.blobs["key-app"]
+	expected := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("data")))
+	if !ok || blob.Backend != "squashfs" || blob.Checksum != expected || blob.Path != blobPath || blob.RefCount != 1 || blob.Size != 4 {
+		t.Fatalf("unexpected blob %+v", blob)
+	}
+}
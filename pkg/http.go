@@ -0,0 +1,147 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// httpStatus is the payload served by the '/status' endpoint
+type httpStatus struct {
+	Started time.Time   `json:"started"`
+	State   ServerState `json:"state"`
+	Uptime  string      `json:"uptime"`
+	Uuid    string      `json:"uuid"`
+	Version string      `json:"version"`
+}
+
+// httpServer is the embedded HTTP server exposing health, readiness, metrics, version and status endpoints
+type httpServer struct {
+	checkHealth entrypointCb
+	ctx         context.Context
+	server      *http.Server
+	started     time.Time
+}
+
+// Serves '/healthz' - returns 200 if the entrypoint's health check passes, 503 otherwise
+func (hs *httpServer) healthz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(hs.ctx, 30*time.Second)
+	defer cancel()
+	err := hs.checkHealth(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// Serves '/metrics' - returns the entrypoint's metrics in the prometheus text format
+func (hs *httpServer) metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	Metrics(hs.ctx).write(w)
+}
+
+// Serves '/readyz' - returns 200 if the server is ready, 503 otherwise
+func (hs *httpServer) readyz(w http.ResponseWriter, r *http.Request) {
+	err := checkServerReady(hs.ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// Serves '/status' - returns a JSON document describing the entrypoint and server state
+func (hs *httpServer) status(w http.ResponseWriter, r *http.Request) {
+	state, err := GetServerState(hs.ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(httpStatus{
+		Started: hs.started,
+		State:   state,
+		Uptime:  time.Since(hs.started).Round(time.Second).String(),
+		Uuid:    Uuid(hs.ctx),
+		Version: Version(hs.ctx),
+	})
+}
+
+// Serves '/version' - returns the entrypoint version
+func (hs *httpServer) version(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, Version(hs.ctx))
+}
+
+// Stops the HTTP server
+func (hs *httpServer) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	hs.server.Shutdown(ctx)
+}
+
+// Starts the embedded HTTP server in the background.
+// The health check defaults to confirming the server is ready if unset.
+// Returns an error if the address cannot be listened on.
+func startHttpServer(ctx context.Context, address string, checkHealth entrypointCb) (*httpServer, error) {
+	if checkHealth == nil {
+		checkHealth = checkServerReady
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	hs := &httpServer{checkHealth: checkHealth, ctx: ctx, started: time.Now()}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", hs.healthz)
+	mux.HandleFunc("GET /metrics", hs.metrics)
+	mux.HandleFunc("GET /readyz", hs.readyz)
+	mux.HandleFunc("GET /status", hs.status)
+	mux.HandleFunc("GET /version", hs.version)
+	hs.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	Logger(ctx).Info("start http server", "address", listener.Addr().String())
+	go func() {
+		err := hs.server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			Logger(ctx).Warn("http server failed", "error", err.Error())
+		}
+	}()
+	return hs, nil
+}
+
+// Checks the health of the server by querying the embedded HTTP server's '/healthz' endpoint.
+// Returns an error if the endpoint cannot be reached or reports the server as unhealthy.
+func checkHealthViaHttp(ctx context.Context, address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	url := fmt.Sprintf("http://%s/healthz", net.JoinHostPort(host, port))
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("GET %s sent non-200 status code: %d (%s)", url, response.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
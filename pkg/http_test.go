@@ -0,0 +1,173 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// Returns a free loopback address
+func freeTestAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// Starts the embedded HTTP server (stopped when the test completes) - returning its context and address
+func startTestHttpServer(t *testing.T, checkHealth entrypointCb) (context.Context, string) {
+	t.Helper()
+	ctx := newTestReadinessContext(t)
+	ctx = context.WithValue(ctx, ctxKeyUuid{}, "test-uuid")
+	ctx = context.WithValue(ctx, ctxKeyVersion{}, "1.2.3")
+	address := freeTestAddress(t)
+	server, err := startHttpServer(ctx, address, checkHealth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.stop)
+	return ctx, address
+}
+
+// Sends a request to the embedded HTTP server - returning the response status code, content type and body
+func requestTestHttpServer(t *testing.T, method string, address string, path string) (int, string, string) {
+	t.Helper()
+	request, err := http.NewRequest(method, fmt.Sprintf("http://%s%s", address, path), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.StatusCode, response.Header.Get("Content-Type"), string(body)
+}
+
+func TestHttpServerReadiness(t *testing.T) {
+	ctx, address := startTestHttpServer(t, nil)
+	for _, path := range []string{"/healthz", "/readyz"} {
+		code, _, body := requestTestHttpServer(t, http.MethodGet, address, path)
+		if code != http.StatusServiceUnavailable || !strings.Contains(body, "state: stopped") {
+			t.Fatalf("%s returned %d %q while stopped", path, code, body)
+		}
+	}
+
+	ReadinessTracker(ctx).start(ctx)
+	for _, path := range []string{"/healthz", "/readyz"} {
+		code, _, body := requestTestHttpServer(t, http.MethodGet, address, path)
+		if code != http.StatusOK {
+			t.Fatalf("%s returned %d %q while ready", path, code, body)
+		}
+	}
+}
+
+func TestHttpServerHealthCheck(t *testing.T) {
+	ctx, address := startTestHttpServer(t, func(ctx context.Context) error {
+		return fmt.Errorf("players unable to join")
+	})
+	ReadinessTracker(ctx).start(ctx)
+
+	// health is determined by the entrypoint's health check - readiness by the server state
+	code, _, body := requestTestHttpServer(t, http.MethodGet, address, "/healthz")
+	if code != http.StatusServiceUnavailable || !strings.Contains(body, "players unable to join") {
+		t.Fatalf("/healthz returned %d %q", code, body)
+	}
+	code, _, _ = requestTestHttpServer(t, http.MethodGet, address, "/readyz")
+	if code != http.StatusOK {
+		t.Fatalf("/readyz returned %d", code)
+	}
+}
+
+func TestHttpServerEndpoints(t *testing.T) {
+	ctx, address := startTestHttpServer(t, nil)
+	AddCounter(ctx, "gsh_test_total", "Test counter", 2, nil)
+	ReadinessTracker(ctx).start(ctx)
+
+	code, contentType, body := requestTestHttpServer(t, http.MethodGet, address, "/metrics")
+	if code != http.StatusOK || !strings.HasPrefix(contentType, "text/plain") || !strings.Contains(body, "gsh_test_total 2\n") {
+		t.Fatalf("/metrics returned %d %s %q", code, contentType, body)
+	}
+
+	code, _, body = requestTestHttpServer(t, http.MethodGet, address, "/version")
+	if code != http.StatusOK || body != "1.2.3" {
+		t.Fatalf("/version returned %d %q", code, body)
+	}
+
+	code, contentType, body = requestTestHttpServer(t, http.MethodGet, address, "/status")
+	if code != http.StatusOK || contentType != "application/json" {
+		t.Fatalf("/status returned %d %s", code, contentType)
+	}
+	status := httpStatus{}
+	err := json.Unmarshal([]byte(body), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != ServerStateReady || status.Uuid != "test-uuid" || status.Version != "1.2.3" || status.Started.IsZero() {
+		t.Fatalf("/status returned %+v", status)
+	}
+
+	code, _, _ = requestTestHttpServer(t, http.MethodPost, address, "/healthz")
+	if code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST /healthz returned %d", code)
+	}
+	code, _, _ = requestTestHttpServer(t, http.MethodGet, address, "/unknown")
+	if code != http.StatusNotFound {
+		t.Fatalf("/unknown returned %d", code)
+	}
+}
+
+func TestHttpServerAddressInUse(t *testing.T) {
+	_, address := startTestHttpServer(t, nil)
+	_, err := startHttpServer(newTestContext(t), address, nil)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestCheckHealthViaHttp(t *testing.T) {
+	healthy := atomic.Bool{}
+	healthy.Store(true)
+	ctx, address := startTestHttpServer(t, func(ctx context.Context) error {
+		if !healthy.Load() {
+			return fmt.Errorf("unhealthy")
+		}
+		return nil
+	})
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wildcard listen addresses are queried via loopback
+	for _, address := range []string{address, fmt.Sprintf("0.0.0.0:%s", port), fmt.Sprintf(":%s", port)} {
+		err = checkHealthViaHttp(ctx, address)
+		if err != nil {
+			t.Fatalf("%s: %v", address, err)
+		}
+	}
+
+	healthy.Store(false)
+	err = checkHealthViaHttp(ctx, address)
+	if err == nil || !strings.Contains(err.Error(), "503") || !strings.Contains(err.Error(), "unhealthy") {
+		t.Fatalf("error %v", err)
+	}
+
+	err = checkHealthViaHttp(ctx, freeTestAddress(t))
+	if err == nil {
+		t.Fatal("expected error querying closed address")
+	}
+}
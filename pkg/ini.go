@@ -0,0 +1,583 @@
+package helper
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// iniLine is a single line of an INI document.
+// Lines without a key (comments, blank lines, unparseable lines - including lines with an empty key) are written back verbatim.
+// Quoted values are unquoted literally - backslashes are not escape sequences (e.g., "C:\Games\x").
+type iniLine struct {
+	key    string
+	prefix string
+	quoted bool
+	raw    string
+	value  string
+}
+
+// Returns the INI representation of the line - unmodified lines are returned as they were read
+func (l *iniLine) String() string {
+	if l.raw != "" || l.key == "" {
+		return l.raw
+	}
+	value := l.value
+	if l.quoted {
+		value = fmt.Sprintf(`"%s"`, value)
+	}
+	return fmt.Sprintf("%s%s=%s", l.prefix, l.key, value)
+}
+
+// iniSection is a section ('[name]') of an INI document.  Keys preceding the first section header belong to an unnamed section.
+type iniSection struct {
+	header string
+	lines  []*iniLine
+	name   string
+}
+
+// iniDocument is a parsed INI document that preserves comments, ordering and formatting of unmodified lines.
+// Unreal Engine array operators are supported: '+Key' (add unique), '.Key' (add), '-Key' (remove) and '!Key' (clear).
+// Keys without an operator that appear multiple times are treated as arrays.
+type iniDocument struct {
+	bom      bool
+	newline  string
+	sections []*iniSection
+}
+
+// Parses INI data into an [iniDocument]
+func parseIni(data []byte) *iniDocument {
+	doc := &iniDocument{newline: "\n"}
+	if bytes.HasPrefix(data, []byte("\ufeff")) {
+		doc.bom = true
+		data = data[3:]
+	}
+	if bytes.Contains(data, []byte("\r\n")) {
+		doc.newline = "\r\n"
+	}
+	section := &iniSection{}
+	doc.sections = append(doc.sections, section)
+	text := strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if text == "" {
+		return doc
+	}
+	for _, raw := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(raw)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = &iniSection{header: raw, name: strings.TrimSpace(trimmed[1 : len(trimmed)-1])}
+			doc.sections = append(doc.sections, section)
+			continue
+		}
+		line := &iniLine{raw: raw}
+		section.lines = append(section.lines, line)
+		if trimmed == "" || strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(trimmed, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		prefix := ""
+		if key != "" && strings.ContainsAny(key[:1], "+-.!") {
+			prefix = key[:1]
+			key = strings.TrimSpace(key[1:])
+		}
+		if key == "" {
+			continue
+		}
+		line.key = key
+		line.prefix = prefix
+		line.value = strings.TrimSpace(value)
+		if len(line.value) >= 2 && strings.HasPrefix(line.value, `"`) && strings.HasSuffix(line.value, `"`) {
+			line.value = line.value[1 : len(line.value)-1]
+			line.quoted = true
+		}
+	}
+	return doc
+}
+
+// Returns the INI representation of the document
+func (doc *iniDocument) bytes() []byte {
+	lines := []string{}
+	for _, section := range doc.sections {
+		if section.header != "" {
+			lines = append(lines, section.header)
+		}
+		for _, line := range section.lines {
+			lines = append(lines, line.String())
+		}
+	}
+	data := strings.Join(lines, doc.newline)
+	if data != "" {
+		data += doc.newline
+	}
+	if doc.bom {
+		data = "\ufeff" + data
+	}
+	return []byte(data)
+}
+
+// Returns the names of the document's sections (in order, without duplicates)
+func (doc *iniDocument) sectionNames() []string {
+	names := []string{}
+	for _, section := range doc.sections {
+		if !slices.ContainsFunc(names, func(name string) bool { return strings.EqualFold(name, section.name) }) {
+			names = append(names, section.name)
+		}
+	}
+	return names
+}
+
+// Returns the names of the keys within a section (in order, without duplicates)
+func (doc *iniDocument) keys(name string) []string {
+	keys := []string{}
+	for _, section := range doc.sections {
+		if !strings.EqualFold(section.name, name) {
+			continue
+		}
+		for _, line := range section.lines {
+			if line.key != "" && !slices.ContainsFunc(keys, func(key string) bool { return strings.EqualFold(key, line.key) }) {
+				keys = append(keys, line.key)
+			}
+		}
+	}
+	return keys
+}
+
+// Returns the values of a key within a section - resolving duplicate keys and array operators
+func (doc *iniDocument) values(name string, key string) []string {
+	values := []string{}
+	for _, section := range doc.sections {
+		if !strings.EqualFold(section.name, name) {
+			continue
+		}
+		for _, line := range section.lines {
+			if line.key == "" || !strings.EqualFold(line.key, key) {
+				continue
+			}
+			switch line.prefix {
+			case "!":
+				values = []string{}
+			case "-":
+				values = slices.DeleteFunc(values, func(value string) bool { return value == line.value })
+			case "+":
+				if !slices.Contains(values, line.value) {
+					values = append(values, line.value)
+				}
+			default:
+				values = append(values, line.value)
+			}
+		}
+	}
+	return values
+}
+
+// Sets the values of a key within a section.
+// Unchanged keys are left as-is.  Existing lines are replaced in place (retaining their operator and quoting) - clear ('!') and remove ('-') operator lines are retained.
+// New keys are added after the last key of the section, and new sections are added to the end of the document.
+func (doc *iniDocument) set(name string, key string, values []string) {
+	exists := slices.ContainsFunc(doc.keys(name), func(existing string) bool { return strings.EqualFold(existing, key) })
+	if exists && slices.Equal(doc.values(name, key), values) {
+		// unchanged keys retain their original formatting
+		return
+	}
+	var target *iniSection
+	index := -1
+	replaced := false
+	template := &iniLine{key: key}
+	for _, section := range doc.sections {
+		if !strings.EqualFold(section.name, name) {
+			continue
+		}
+		if index == -1 {
+			target = section
+		}
+		lines := []*iniLine{}
+		for _, line := range section.lines {
+			if line.key == "" || !strings.EqualFold(line.key, key) {
+				lines = append(lines, line)
+				continue
+			}
+			if line.prefix == "!" || line.prefix == "-" {
+				lines = append(lines, line)
+				if !replaced {
+					// values follow the operators that clear (or remove from) inherited values
+					target = section
+					index = len(lines)
+					template = &iniLine{key: line.key, prefix: "+"}
+				}
+				continue
+			}
+			if !replaced {
+				target = section
+				index = len(lines)
+				template = line
+				replaced = true
+			}
+		}
+		section.lines = lines
+	}
+	if target == nil {
+		target = &iniSection{header: fmt.Sprintf("[%s]", name), name: name}
+		previous := doc.sections[len(doc.sections)-1]
+		if len(previous.lines) > 0 && strings.TrimSpace(previous.lines[len(previous.lines)-1].String()) != "" {
+			previous.lines = append(previous.lines, &iniLine{})
+		}
+		doc.sections = append(doc.sections, target)
+	}
+	if index == -1 {
+		// after the section's last key - or, for sections without keys, before any trailing blank lines
+		index = 0
+		for position, line := range target.lines {
+			if line.key != "" {
+				index = position + 1
+			}
+		}
+		if index == 0 && target.name != "" {
+			for index < len(target.lines) && strings.TrimSpace(target.lines[index].String()) != "" {
+				index += 1
+			}
+		}
+	}
+	lines := []*iniLine{}
+	for _, value := range values {
+		lines = append(lines, &iniLine{key: template.key, prefix: template.prefix, quoted: template.quoted || strings.TrimSpace(value) != value, value: value})
+	}
+	target.lines = slices.Insert(target.lines, index, lines...)
+}
+
+// iniField is a struct field mapped to an INI section or key via its 'ini' struct tag (e.g., `ini:"Name,omitempty"`)
+type iniField struct {
+	name      string
+	omitEmpty bool
+	value     reflect.Value
+}
+
+// Returns the fields of a struct value that map to INI sections or keys
+func getIniFields(value reflect.Value) []iniField {
+	fields := []iniField{}
+	for index := 0; index < value.NumField(); index++ {
+		field := value.Type().Field(index)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("ini"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, iniField{name: name, omitEmpty: options == "omitempty", value: value.Field(index)})
+	}
+	return fields
+}
+
+// Returns true if the value maps to an INI section
+func isIniSection(value reflect.Value) bool {
+	return value.Kind() == reflect.Struct || (value.Kind() == reflect.Map && value.Type().Key().Kind() == reflect.String)
+}
+
+// Returns true if the type maps to a single INI value
+func isIniScalar(kind reflect.Type) bool {
+	switch kind.Kind() {
+	case reflect.Bool, reflect.Float32, reflect.Float64, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.String, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// Formats a value as INI values (slices produce a value per element).
+// Booleans follow the capitalization of the existing value (i.e., Unreal Engine's 'True'/'False').
+// Returns an error if the value's type is unsupported.
+func formatIniValues(value reflect.Value, existing []string) ([]string, error) {
+	for value.Kind() == reflect.Interface || value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return []string{}, nil
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		values := []string{}
+		for index := 0; index < value.Len(); index++ {
+			formatted, err := formatIniValues(value.Index(index), existing)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, formatted...)
+		}
+		return values, nil
+	case reflect.Bool:
+		formatted := strconv.FormatBool(value.Bool())
+		if len(existing) > 0 && existing[0] != "" && unicode.IsUpper(rune(existing[0][0])) {
+			formatted = strings.ToUpper(formatted[:1]) + formatted[1:]
+		}
+		return []string{formatted}, nil
+	case reflect.Float32, reflect.Float64:
+		return []string{strconv.FormatFloat(value.Float(), 'f', -1, 64)}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return []string{strconv.FormatInt(value.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return []string{strconv.FormatUint(value.Uint(), 10)}, nil
+	case reflect.String:
+		return []string{value.String()}, nil
+	}
+	return nil, fmt.Errorf("unsupported ini value type %s", value.Type())
+}
+
+// Parses INI values into a value (slices receive every value - other types receive the last value).
+// Returns an error if a value cannot be coerced into the value's type.
+func parseIniValues(value reflect.Value, values []string) error {
+	if value.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(value.Type(), len(values), len(values))
+		for index, item := range values {
+			err := parseIniValues(slice.Index(index), []string{item})
+			if err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+		return nil
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	data := values[len(values)-1]
+	switch value.Kind() {
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(strings.ToLower(data))
+		if err != nil {
+			return err
+		}
+		value.SetBool(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(data, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(data, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(data, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(parsed)
+	case reflect.String:
+		value.SetString(data)
+	case reflect.Interface:
+		if len(values) == 1 {
+			value.Set(reflect.ValueOf(data))
+			return nil
+		}
+		items := []any{}
+		for _, item := range values {
+			items = append(items, item)
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported ini value type %s", value.Type())
+	}
+	return nil
+}
+
+// Decodes an INI section into a struct or map value.
+// Returns an error if any key cannot be decoded.
+func (doc *iniDocument) decodeSection(name string, value reflect.Value) error {
+	if value.Kind() == reflect.Map {
+		if value.IsNil() {
+			value.Set(reflect.MakeMap(value.Type()))
+		}
+		for _, key := range doc.keys(name) {
+			item := reflect.New(value.Type().Elem()).Elem()
+			err := parseIniValues(item, doc.values(name, key))
+			if err != nil {
+				return fmt.Errorf("[%s] %s: %w", name, key, err)
+			}
+			value.SetMapIndex(reflect.ValueOf(key).Convert(value.Type().Key()), item)
+		}
+		return nil
+	}
+	for _, field := range getIniFields(value) {
+		values := doc.values(name, field.name)
+		if len(values) == 0 && !slices.ContainsFunc(doc.keys(name), func(key string) bool { return strings.EqualFold(key, field.name) }) {
+			continue
+		}
+		err := parseIniValues(field.value, values)
+		if err != nil {
+			return fmt.Errorf("[%s] %s: %w", name, field.name, err)
+		}
+	}
+	return nil
+}
+
+// Encodes a struct or map value into an INI section.
+// Returns an error if any key cannot be encoded.
+func (doc *iniDocument) encodeSection(name string, value reflect.Value) error {
+	if value.Kind() == reflect.Map {
+		keys := value.MapKeys()
+		slices.SortFunc(keys, func(a reflect.Value, b reflect.Value) int { return strings.Compare(a.String(), b.String()) })
+		for _, key := range keys {
+			values, err := formatIniValues(value.MapIndex(key), doc.values(name, key.String()))
+			if err != nil {
+				return fmt.Errorf("[%s] %s: %w", name, key.String(), err)
+			}
+			doc.set(name, key.String(), values)
+		}
+		return nil
+	}
+	for _, field := range getIniFields(value) {
+		if field.omitEmpty && field.value.IsZero() {
+			continue
+		}
+		values, err := formatIniValues(field.value, doc.values(name, field.name))
+		if err != nil {
+			return fmt.Errorf("[%s] %s: %w", name, field.name, err)
+		}
+		doc.set(name, field.name, values)
+	}
+	return nil
+}
+
+// Returns the underlying struct or map of a value (dereferencing pointers and interfaces)
+func getIniTarget(value reflect.Value) reflect.Value {
+	for (value.Kind() == reflect.Interface || value.Kind() == reflect.Pointer) && !value.IsNil() {
+		value = value.Elem()
+	}
+	return value
+}
+
+// Marshals data (a struct or a map of sections) into INI, merging it into existing INI data (which may be empty).
+// Struct fields (and map keys) holding structs or maps are sections - other fields are keys within the unnamed (i.e., global) section.
+// Slices are written as repeated keys.  Comments, ordering and keys absent from data are preserved.
+// Returns an error if data is not a struct or map.
+// Returns an error if any value has an unsupported type.
+func marshalIni(data any, existing []byte) ([]byte, error) {
+	doc := parseIni(existing)
+	value := getIniTarget(reflect.ValueOf(data))
+	switch value.Kind() {
+	case reflect.Map:
+		keys := value.MapKeys()
+		slices.SortFunc(keys, func(a reflect.Value, b reflect.Value) int { return strings.Compare(a.String(), b.String()) })
+		for _, key := range keys {
+			section := getIniTarget(value.MapIndex(key))
+			if !isIniSection(section) {
+				values, err := formatIniValues(section, doc.values("", key.String()))
+				if err != nil {
+					return nil, err
+				}
+				doc.set("", key.String(), values)
+				continue
+			}
+			err := doc.encodeSection(key.String(), section)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case reflect.Struct:
+		for _, field := range getIniFields(value) {
+			section := getIniTarget(field.value)
+			if isIniSection(section) {
+				err := doc.encodeSection(field.name, section)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if field.omitEmpty && field.value.IsZero() {
+				continue
+			}
+			values, err := formatIniValues(field.value, doc.values("", field.name))
+			if err != nil {
+				return nil, err
+			}
+			doc.set("", field.name, values)
+		}
+	default:
+		return nil, fmt.Errorf("ini data must be a struct or map")
+	}
+	return doc.bytes(), nil
+}
+
+// Unmarshals INI data into a struct or map pointer (see: [marshalIni]).
+// When unmarshalling into a map, each section is a map of keys to values - repeated keys produce a list of values.
+// Returns an error if data is not a pointer to a struct or map.
+// Returns an error if any value cannot be coerced into its field's type.
+func unmarshalIni(data []byte, to any) error {
+	doc := parseIni(data)
+	value := reflect.ValueOf(to)
+	if value.Kind() != reflect.Pointer || value.IsNil() {
+		return fmt.Errorf("data must be pointer")
+	}
+	value = value.Elem()
+	switch value.Kind() {
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("ini map keys must be strings")
+		}
+		if value.IsNil() {
+			value.Set(reflect.MakeMap(value.Type()))
+		}
+		elem := value.Type().Elem()
+		for _, name := range doc.sectionNames() {
+			if name == "" {
+				if elem.Kind() != reflect.Interface && !isIniScalar(elem) {
+					continue
+				}
+				for _, key := range doc.keys("") {
+					item := reflect.New(elem).Elem()
+					err := parseIniValues(item, doc.values("", key))
+					if err != nil {
+						return fmt.Errorf("%s: %w", key, err)
+					}
+					value.SetMapIndex(reflect.ValueOf(key).Convert(value.Type().Key()), item)
+				}
+				continue
+			}
+			section := reflect.New(elem).Elem()
+			if elem.Kind() == reflect.Interface {
+				section = reflect.ValueOf(map[string]any{})
+			}
+			if section.Kind() != reflect.Map && section.Kind() != reflect.Struct {
+				return fmt.Errorf("ini map values must be sections (maps or structs)")
+			}
+			err := doc.decodeSection(name, section)
+			if err != nil {
+				return err
+			}
+			value.SetMapIndex(reflect.ValueOf(name).Convert(value.Type().Key()), section)
+		}
+	case reflect.Struct:
+		for _, field := range getIniFields(value) {
+			if isIniSection(field.value) {
+				err := doc.decodeSection(field.name, field.value)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			values := doc.values("", field.name)
+			if len(values) == 0 {
+				continue
+			}
+			err := parseIniValues(field.value, values)
+			if err != nil {
+				return fmt.Errorf("%s: %w", field.name, err)
+			}
+		}
+	default:
+		return fmt.Errorf("data must be pointer to a struct or map")
+	}
+	return nil
+}
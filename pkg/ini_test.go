@@ -0,0 +1,48 @@
+package helper
+
+import (
+	"testing"
+)
+
+func TestParseIniEmptyKey(t *testing.T) {
+	data := "=value\n = x\n+=y\n[Section]\nKey=1\n"
+	values := map[string]any{}
+	err := unmarshalIni([]byte(data), &values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	section, ok := values["Section"].(map[string]any)
+	if !ok || section["Key"] != "1" {
+		t.Fatalf("unexpected values %v", values)
+	}
+
+	output, err := marshalIni(map[string]any{"Section": map[string]any{"Key": 2}}, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "=value\n = x\n+=y\n[Section]\nKey=2\n"
+	if string(output) != expected {
+		t.Fatalf("marshalled %q (expected %q)", output, expected)
+	}
+}
+
+func TestParseIniLiteralQuotes(t *testing.T) {
+	data := "[Paths]\nGame=\"C:\\Games\\x\"\nOther=1\n"
+	values := map[string]map[string]string{}
+	err := unmarshalIni([]byte(data), &values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["Paths"]["Game"] != `C:\Games\x` {
+		t.Fatalf("unquoted %q (expected %q)", values["Paths"]["Game"], `C:\Games\x`)
+	}
+
+	output, err := marshalIni(map[string]any{"Paths": map[string]any{"Game": `D:\Games\y`}}, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[Paths]\nGame=\"D:\\Games\\y\"\nOther=1\n"
+	if string(output) != expected {
+		t.Fatalf("marshalled %q (expected %q)", output, expected)
+	}
+}
@@ -1,9 +1,11 @@
 package helper
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"reflect"
 
 	jsonpatch "github.com/evanphx/json-patch/v5"
@@ -46,3 +48,149 @@ func ApplyJsonPatches(ctx context.Context, to any, patches ...JsonPatch) error {
 
 	return json.Unmarshal(toBytes, &to)
 }
+
+// Decodes JSON data into value - decoding numbers losslessly as [json.Number] values (rather than float64 values that lose the precision of large integers)
+func unmarshalJsonNumbers(data []byte, value any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(value)
+}
+
+// Normalizes [json.Number] values (produced when decoding with [json.Decoder.UseNumber]) within decoded JSON data into int64 (for integers) or float64 values
+func normalizeJsonNumbers(data any) any {
+	switch data := data.(type) {
+	case json.Number:
+		integer, err := data.Int64()
+		if err == nil {
+			return integer
+		}
+		float, err := data.Float64()
+		if err == nil {
+			return float
+		}
+		return data.String()
+	case map[string]any:
+		for key, value := range data {
+			data[key] = normalizeJsonNumbers(value)
+		}
+	case []any:
+		for index, value := range data {
+			data[index] = normalizeJsonNumbers(value)
+		}
+	}
+	return data
+}
+
+// Returns true if any key present in the original (decoded JSON) data is absent from the patched data
+func hasRemovedKeys(original any, patched any) bool {
+	originalMap, ok := original.(map[string]any)
+	if !ok {
+		return false
+	}
+	patchedMap, ok := patched.(map[string]any)
+	if !ok {
+		return true
+	}
+	for key, value := range originalMap {
+		patchedValue, ok := patchedMap[key]
+		if !ok || hasRemovedKeys(value, patchedValue) {
+			return true
+		}
+	}
+	return false
+}
+
+// Applies a patch to a config file on disk - using the format registered for the file's extension (see: [RegisterFileFormat]).
+// See: [PatchFileAs]
+func PatchFile(ctx context.Context, file string, patch []byte) error {
+	format, err := detectFileFormat(file)
+	if err != nil {
+		return err
+	}
+	return PatchFileAs(ctx, file, patch, format)
+}
+
+// Applies a patch to a config file on disk using an explicit (registered) format.
+// A patch holding a JSON array is applied as an RFC6902 JSON patch - a patch holding a JSON object is applied as an RFC7386 merge patch.
+// The file is decoded as a document of (string-keyed) maps, patched, and written back in place in its original format (following symlinks and retaining its mode and owner).
+// Formats that preserve comments (i.e., INI and .properties) rewrite the file from scratch if the patch removes a key - losing the file's comments, blank lines and key order.
+// XML is unsupported - XML documents cannot be decoded into maps.
+// Returns an error if the format is not registered (or is XML).
+// Returns an error if the file cannot be read, decoded or written.
+// Returns an error if the patch is invalid or cannot be applied.
+func PatchFileAs(ctx context.Context, file string, patch []byte, format string) error {
+	Logger(ctx).Info("patch file", "path", file, "format", format)
+	if format == "xml" {
+		return fmt.Errorf("format xml cannot be patched")
+	}
+	codec, err := getFileFormat(format)
+	if err != nil {
+		return err
+	}
+	stat, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	existing, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	original := map[string]any{}
+	err = codec.Unmarshal(existing, &original)
+	if err != nil {
+		return err
+	}
+	originalBytes, err := json.Marshal(original)
+	if err != nil {
+		return err
+	}
+
+	var patchedBytes []byte
+	patch = bytes.TrimSpace(patch)
+	switch {
+	case bytes.HasPrefix(patch, []byte("[")):
+		jsonPatch, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return err
+		}
+		patchedBytes, err = jsonPatch.Apply(originalBytes)
+		if err != nil {
+			return err
+		}
+	case bytes.HasPrefix(patch, []byte("{")):
+		patchedBytes, err = jsonpatch.MergePatch(originalBytes, patch)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("patch must be a json array (rfc6902) or a json object (rfc7386)")
+	}
+
+	// decode numbers losslessly - otherwise integers are re-encoded as floats (e.g., '1e+06')
+	var patched any
+	err = unmarshalJsonNumbers(patchedBytes, &patched)
+	if err != nil {
+		return err
+	}
+	patched = normalizeJsonNumbers(patched)
+	if _, ok := patched.(map[string]any); !ok {
+		return fmt.Errorf("patched document must be an object")
+	}
+
+	// json roundtrips the original document identically - used to detect removed keys
+	var roundtripped any
+	err = json.Unmarshal(originalBytes, &roundtripped)
+	if err != nil {
+		return err
+	}
+	merge := existing
+	if hasRemovedKeys(roundtripped, patched) {
+		Logger(ctx).Warn("patch removes keys - rewriting file", "path", file)
+		merge = nil
+	}
+	dataBytes, err := codec.Marshal(patched, merge)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, dataBytes, stat.Mode().Perm())
+}
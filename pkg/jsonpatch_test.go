@@ -0,0 +1,62 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPatchFileInPlace(t *testing.T) {
+	ctx := newTestContext(t)
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.json")
+	err := os.WriteFile(target, []byte(`{"a": 1}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.json")
+	err = os.Symlink(target, link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = PatchFile(ctx, link, []byte(`{"b": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lstat, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lstat.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("symlink replaced by a regular file")
+	}
+	stat, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode().Perm() != 0600 {
+		t.Fatalf("mode changed to %s", stat.Mode().Perm())
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"b"`) {
+		t.Fatalf("target holds %q", data)
+	}
+}
+
+func TestPatchFileXml(t *testing.T) {
+	ctx := newTestContext(t)
+	file := filepath.Join(t.TempDir(), "config.xml")
+	err := os.WriteFile(file, []byte(`<config></config>`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = PatchFile(ctx, file, []byte(`{"a": 1}`))
+	if err == nil || !strings.Contains(err.Error(), "xml") {
+		t.Fatalf("unexpected error %v (expected xml to be rejected)", err)
+	}
+}
@@ -2,12 +2,14 @@ package helper
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/caarlos0/env/v11"
 	"github.com/google/uuid"
 )
 
@@ -16,16 +18,31 @@ type entrypointCb func(ctx context.Context) error
 
 // An Entrypoint wraps common tasks that need to be performed by many game server docker images.
 type Entrypoint struct {
-	CheckHealth        entrypointCb
-	ctx                context.Context
-	Dirs               Map[string, string]
-	FileCacheEnabled   bool `env:"CACHE_ENABLED"`
-	FileCacheSizeLimit int  `env:"CACHE_SIZE_LIMIT"`
-	Initialize         func(ctx context.Context) error
-	logger             *slog.Logger
-	Main               entrypointCb
-	uuid               string
-	Version            string
+	Backup                    BackupOpts
+	CheckHealth               entrypointCb
+	Config                    any
+	ConfigFiles               Map[string, string]
+	ConfigOverlayAllowlist    []string
+	ctx                       context.Context
+	Dirs                      Map[string, string]
+	FileCacheBackend          string `env:"CACHE_BACKEND"`
+	FileCacheContentAddressed bool   `env:"CACHE_CONTENT_ADDRESSED"`
+	FileCacheEnabled          bool   `env:"CACHE_ENABLED"`
+	FileCacheSizeLimit        int    `env:"CACHE_SIZE_LIMIT"`
+	FileCacheVerify           string `env:"CACHE_VERIFY"`
+	HttpAddress               string `env:"HTTP_ADDRESS"`
+	Initialize                func(ctx context.Context) error
+	logger                    *slog.Logger
+	Main                      entrypointCb
+	Rcon                      RconOpts
+	Readiness                 []ReadinessCheck
+	SecretsDir                string `env:"SECRETS_DIR"`
+	secrets                   *secrets
+	Shutdown                  []ShutdownStep
+	ShutdownGracePeriod       time.Duration `env:"SHUTDOWN_GRACE_PERIOD"`
+	StatusFile                string        `env:"STATUS_FILE"`
+	uuid                      string
+	Version                   string
 }
 
 // 'Bootstraps' the entrypoint.
@@ -57,7 +74,8 @@ func bootstrap(ctx context.Context) error {
 		return err
 	}
 
-	_, err = Command(ctx, []string{executable, "entrypoint"}, CmdOpts{Attach: true, Env: os.Environ(), User: runAsUser}).Run()
+	// the relaunched entrypoint performs its own graceful shutdown - never kill it from here
+	_, err = Command(ctx, []string{executable, "entrypoint"}, CmdOpts{Attach: true, Env: os.Environ(), Stop: CmdStopOpts{GracePeriod: -1}, User: runAsUser}).Run()
 	return err
 }
 
@@ -65,14 +83,42 @@ func bootstrap(ctx context.Context) error {
 func (e *Entrypoint) initialize() error {
 	e.ctx = context.Background()
 
-	// set logger early to ensure that errors during initialization can be logged
-	e.logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+	// set logger early to ensure that errors during initialization can be logged - secrets are redacted as they are discovered
+	e.secrets = newSecrets()
+	e.logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{ReplaceAttr: e.secrets.replaceAttr}))
+	e.secrets.logger = e.logger
 	e.ctx = context.WithValue(e.ctx, ctxKeyLogger{}, e.logger)
 
-	err := env.Parse(e)
-	if err != nil {
-		return err
+	// the secrets directory is needed to parse the remaining config
+	secretsDir, ok := os.LookupEnv("SECRETS_DIR")
+	if !ok {
+		secretsDir = e.SecretsDir
+	}
+	if secretsDir == "" {
+		secretsDir = secretsDirDefault
+	}
+
+	// parse and validate the entrypoint and image configs together - reporting every invalid variable at once
+	validationErrors := ValidationErrors{}
+	for _, cfg := range []any{e, e.Config} {
+		if cfg == nil {
+			continue
+		}
+		err := parseAndValidateConfig(cfg, e.secrets, secretsDir)
+		cfgErrors := ValidationErrors{}
+		if errors.As(err, &cfgErrors) {
+			validationErrors = append(validationErrors, cfgErrors...)
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(validationErrors) > 0 {
+		for _, validationError := range validationErrors {
+			e.logger.Error("invalid config", "variable", validationError.Variable, "field", validationError.Field, "value", validationError.Value, "error", validationError.Message)
+		}
+		return validationErrors
 	}
+	e.SecretsDir = secretsDir
 	if e.Dirs == nil {
 		e.Dirs = Map[string, string]{}
 	}
@@ -86,6 +132,19 @@ func (e *Entrypoint) initialize() error {
 		}
 		e.Dirs[key] = filepath.Join(wd, path)
 	}
+	if e.ConfigFiles == nil {
+		e.ConfigFiles = Map[string, string]{}
+	}
+	for key, path := range e.ConfigFiles {
+		if filepath.IsAbs(path) {
+			continue
+		}
+		e.ConfigFiles[key] = filepath.Join(wd, path)
+	}
+	err = e.Backup.validate(e.Dirs)
+	if err != nil {
+		return err
+	}
 	if e.Main == nil {
 		return fmt.Errorf("main unset")
 	}
@@ -93,20 +152,46 @@ func (e *Entrypoint) initialize() error {
 	if e.Version == "" {
 		return fmt.Errorf("version unset")
 	}
+	if e.FileCacheBackend == "" {
+		e.FileCacheBackend = fileCacheBackendDefault
+	}
+	_, err = getFileCacheBackend(e.FileCacheBackend)
+	if err != nil {
+		return err
+	}
+	fileCacheVerifyRate, err := parseFileCacheVerify(e.FileCacheVerify)
+	if err != nil {
+		return err
+	}
+	if e.StatusFile == "" {
+		e.StatusFile = defaultStatusFile()
+	}
+	if e.ShutdownGracePeriod == 0 {
+		e.ShutdownGracePeriod = shutdownGracePeriodDefault
+	}
+	readiness, err := newReadiness(e.Readiness, e.StatusFile)
+	if err != nil {
+		return err
+	}
 
+	e.ctx = context.WithValue(e.ctx, ctxKeyBackupConfig{}, e.Backup)
+	e.ctx = context.WithValue(e.ctx, ctxKeyConfigFiles{}, e.ConfigFiles)
+	e.ctx = context.WithValue(e.ctx, ctxKeyConfigOverlayAllowlist{}, e.ConfigOverlayAllowlist)
 	e.ctx = context.WithValue(e.ctx, ctxKeyDirs{}, e.Dirs)
+	e.ctx = context.WithValue(e.ctx, ctxKeyFileCacheBackend{}, e.FileCacheBackend)
+	e.ctx = context.WithValue(e.ctx, ctxKeyFileCacheContentAddressed{}, e.FileCacheContentAddressed)
 	e.ctx = context.WithValue(e.ctx, ctxKeyFileCacheEnabled{}, e.FileCacheEnabled)
 	e.ctx = context.WithValue(e.ctx, ctxKeyFileCacheSizeLimit{}, e.FileCacheSizeLimit)
+	e.ctx = context.WithValue(e.ctx, ctxKeyFileCacheVerifyRate{}, fileCacheVerifyRate)
+	e.ctx = context.WithValue(e.ctx, ctxKeyMetrics{}, newMetrics())
+	e.ctx = context.WithValue(e.ctx, ctxKeyRconConfig{}, e.Rcon)
+	e.ctx = context.WithValue(e.ctx, ctxKeyReadiness{}, readiness)
+	e.ctx = context.WithValue(e.ctx, ctxKeySecrets{}, e.secrets)
+	e.ctx = context.WithValue(e.ctx, ctxKeySecretsDir{}, e.SecretsDir)
+	e.ctx = context.WithValue(e.ctx, ctxKeyShutdown{}, newShutdown(nil, e.ShutdownGracePeriod))
 	e.ctx = context.WithValue(e.ctx, ctxKeyUuid{}, e.uuid)
 	e.ctx = context.WithValue(e.ctx, ctxKeyVersion{}, e.Version)
 
-	if e.Initialize != nil {
-		err := e.Initialize(e.ctx)
-		if err != nil {
-			return err
-		}
-	}
-
 	return nil
 }
 
@@ -116,30 +201,88 @@ func printVersion(ctx context.Context) error {
 	return nil
 }
 
+// Returns a callback that sends a console command (composed of the provided arguments) to the rcon server and prints its output
+func rconExec(args ...string) entrypointCb {
+	return func(ctx context.Context) error {
+		if len(args) == 0 {
+			return fmt.Errorf("rcon command unset")
+		}
+		output, err := RconExec(ctx, strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+		fmt.Println(output)
+		return nil
+	}
+}
+
 // Runs the helper with the provided arguments.
 // Returns an error on failure.
 func (e *Entrypoint) main(args ...string) error {
+	cmd := "bootstrap"
+	if len(args) >= 2 {
+		cmd = args[1]
+	}
+
 	err := e.initialize()
+	validationErrors := ValidationErrors{}
+	if cmd == "config" && errors.As(err, &validationErrors) {
+		fmt.Print(validationErrors.report())
+	}
 	if err != nil {
 		return err
 	}
 
-	cmd := "bootstrap"
-	if len(args) >= 2 {
-		cmd = args[1]
+	// config commands inspect the configuration without starting anything
+	if e.Initialize != nil && cmd != "config" {
+		err := e.Initialize(e.ctx)
+		if err != nil {
+			return err
+		}
 	}
 
 	var callback entrypointCb
 	switch cmd {
 	case "bootstrap":
 		callback = bootstrap
+	case "cache":
+		callback = cacheCommand(args[2:]...)
+	case "config":
+		callback = configCommand(args[2:]...)
+	case "backup":
+		callback = backupCommand(args[2:]...)
 	case "entrypoint":
+		// the shutdown hook chain only runs within the process hosting the game server
+		e.ctx = context.WithValue(e.ctx, ctxKeyShutdown{}, newShutdown(e.Shutdown, e.ShutdownGracePeriod))
+		if e.Backup.Source != "" && e.Backup.Interval > 0 {
+			schedule := startBackupSchedule(e.ctx, e.Backup.Interval)
+			defer schedule.close()
+		}
+		ReadinessTracker(e.ctx).reset(e.ctx)
+		if e.HttpAddress != "" {
+			server, err := startHttpServer(e.ctx, e.HttpAddress, e.CheckHealth)
+			if err != nil {
+				return err
+			}
+			defer server.stop()
+		}
 		callback = e.Main
-	case "health":
-		if e.CheckHealth == nil {
-			return fmt.Errorf("check health unimplemented")
+		if e.Backup.Source != "" && e.Backup.OnShutdown {
+			callback = withShutdownBackup(callback)
 		}
+	case "health":
 		callback = e.CheckHealth
+		if callback == nil {
+			callback = checkServerReady
+		}
+		if e.HttpAddress != "" {
+			// the entrypoint process serves health checks - query it rather than running the check here
+			callback = func(ctx context.Context) error {
+				return checkHealthViaHttp(ctx, e.HttpAddress)
+			}
+		}
+	case "rcon":
+		callback = rconExec(args[2:]...)
 	case "version":
 		callback = printVersion
 	default:
@@ -0,0 +1,226 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// procClockTicks is the number of clock ticks per second used by /proc/[pid]/stat (USER_HZ - 100 on effectively all linux systems)
+const procClockTicks = 100
+
+// metricKind is the prometheus type of a metric
+type metricKind string
+
+const (
+	metricKindCounter metricKind = "counter"
+	metricKindGauge   metricKind = "gauge"
+	metricKindSummary metricKind = "summary"
+)
+
+// metricSeries is a single labelled time series of a metric
+type metricSeries struct {
+	count  int
+	labels string
+	value  float64
+}
+
+// metric is a named metric holding one or more labelled time series
+type metric struct {
+	help   string
+	kind   metricKind
+	series Map[string, *metricSeries]
+}
+
+// metrics is a registry of metrics exposed in the prometheus text format
+type metrics struct {
+	lock           sync.Mutex
+	metrics        Map[string, *metric]
+	serverCpu      float64
+	serverCpuTotal float64
+	serverPid      int
+	serverStarted  time.Time
+}
+
+// Creates a new, empty [metrics] registry
+func newMetrics() *metrics {
+	return &metrics{metrics: Map[string, *metric]{}}
+}
+
+// Formats labels in the prometheus text format (i.e., '{a="b",c="d"}'), sorted by label name
+func formatMetricLabels(labels Map[string, string]) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := labels.Keys()
+	slices.Sort(keys)
+	pairs := []string{}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, key, replacer.Replace(labels[key])))
+	}
+	return fmt.Sprintf("{%s}", strings.Join(pairs, ","))
+}
+
+// Retrieves (creating if necessary) a time series.  Must be called while holding the lock.
+func (m *metrics) getSeries(name string, help string, kind metricKind, labels Map[string, string]) *metricSeries {
+	item, ok := m.metrics[name]
+	if !ok {
+		item = &metric{help: help, kind: kind, series: Map[string, *metricSeries]{}}
+		m.metrics[name] = item
+	}
+	formatted := formatMetricLabels(labels)
+	series, ok := item.series[formatted]
+	if !ok {
+		series = &metricSeries{labels: formatted}
+		item.series[formatted] = series
+	}
+	return series
+}
+
+// Adds a value to a counter
+func (m *metrics) add(name string, help string, value float64, labels Map[string, string]) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.getSeries(name, help, metricKindCounter, labels).value += value
+}
+
+// Records an observation within a summary (exposed as '<name>_sum' and '<name>_count')
+func (m *metrics) observe(name string, help string, value float64, labels Map[string, string]) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	series := m.getSeries(name, help, metricKindSummary, labels)
+	series.count += 1
+	series.value += value
+}
+
+// Sets the value of a gauge
+func (m *metrics) set(name string, help string, value float64, labels Map[string, string]) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.getSeries(name, help, metricKindGauge, labels).value = value
+}
+
+// Records the pid of the (running) game server process - a pid of 0 indicates that the server is not running.
+// The cpu time last observed for the previous process is carried over so that the cpu counter never decreases across restarts.
+func (m *metrics) setServerPid(pid int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.serverCpuTotal += m.serverCpu
+	m.serverCpu = 0
+	m.serverPid = pid
+	m.serverStarted = time.Now()
+}
+
+// Collects metrics describing the game server process (uptime, cpu, memory) from /proc.
+// Cpu time is exposed as a counter accumulated across every game server process.
+func (m *metrics) collectServerProcess() {
+	m.lock.Lock()
+	pid := m.serverPid
+	started := m.serverStarted
+	m.lock.Unlock()
+
+	up := 0.0
+	uptime := 0.0
+	cpu := 0.0
+	memory := 0.0
+	if pid != 0 {
+		up = 1
+		uptime = time.Since(started).Seconds()
+		cpu, memory = readProcStats(pid)
+	}
+	m.set("gsh_server_up", "Whether the game server process is running", up, nil)
+	m.set("gsh_server_uptime_seconds", "Seconds since the game server process was started", uptime, nil)
+	m.set("gsh_server_memory_bytes", "Resident memory of the game server process", memory, nil)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if pid != 0 && pid == m.serverPid {
+		m.serverCpu = max(m.serverCpu, cpu)
+	}
+	m.getSeries("gsh_server_cpu_seconds_total", "CPU time (user + system) consumed by game server processes", metricKindCounter, nil).value = m.serverCpuTotal + m.serverCpu
+}
+
+// Writes all metrics in the prometheus text exposition format
+func (m *metrics) write(writer io.Writer) error {
+	m.collectServerProcess()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	names := m.metrics.Keys()
+	slices.Sort(names)
+	builder := strings.Builder{}
+	for _, name := range names {
+		item := m.metrics[name]
+		fmt.Fprintf(&builder, "# HELP %s %s\n", name, item.help)
+		fmt.Fprintf(&builder, "# TYPE %s %s\n", name, item.kind)
+		labels := item.series.Keys()
+		slices.Sort(labels)
+		for _, label := range labels {
+			series := item.series[label]
+			value := strconv.FormatFloat(series.value, 'g', -1, 64)
+			if item.kind == metricKindSummary {
+				fmt.Fprintf(&builder, "%s_sum%s %s\n", name, label, value)
+				fmt.Fprintf(&builder, "%s_count%s %d\n", name, label, series.count)
+				continue
+			}
+			fmt.Fprintf(&builder, "%s%s %s\n", name, label, value)
+		}
+	}
+	_, err := io.WriteString(writer, builder.String())
+	return err
+}
+
+// Reads the cpu time (in seconds) and resident memory (in bytes) of a process from /proc.
+// Returns zeroes if the process' stats cannot be read.
+func readProcStats(pid int) (float64, float64) {
+	cpu := 0.0
+	memory := 0.0
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err == nil {
+		// the process name (field 2) may contain spaces - fields are parsed after its closing parenthesis
+		index := strings.LastIndexByte(string(stat), ')')
+		fields := strings.Fields(string(stat)[index+1:])
+		if len(fields) > 12 {
+			utime, _ := strconv.ParseFloat(fields[11], 64)
+			stime, _ := strconv.ParseFloat(fields[12], 64)
+			cpu = (utime + stime) / procClockTicks
+		}
+	}
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err == nil {
+		for _, line := range strings.Split(string(status), "\n") {
+			value, ok := strings.CutPrefix(line, "VmRSS:")
+			if !ok {
+				continue
+			}
+			fields := strings.Fields(value)
+			if len(fields) > 0 {
+				kilobytes, _ := strconv.ParseFloat(fields[0], 64)
+				memory = kilobytes * 1024
+			}
+		}
+	}
+	return cpu, memory
+}
+
+// Adds a value to a counter metric within the entrypoint's metrics registry
+func AddCounter(ctx context.Context, name string, help string, value float64, labels Map[string, string]) {
+	Metrics(ctx).add(name, help, value, labels)
+}
+
+// Records a duration within a summary metric of the entrypoint's metrics registry
+func ObserveDuration(ctx context.Context, name string, help string, duration time.Duration, labels Map[string, string]) {
+	Metrics(ctx).observe(name, help, duration.Seconds(), labels)
+}
+
+// Sets the value of a gauge metric within the entrypoint's metrics registry
+func SetGauge(ctx context.Context, name string, help string, value float64, labels Map[string, string]) {
+	Metrics(ctx).set(name, help, value, labels)
+}
@@ -0,0 +1,110 @@
+package helper
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	testContextValues[ctxKeyMetrics{}] = func() any { return newMetrics() }
+}
+
+// Returns the exposition of a metrics registry
+func writeTestMetrics(t *testing.T, registry *metrics) string {
+	t.Helper()
+	output := bytes.Buffer{}
+	err := registry.write(&output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return output.String()
+}
+
+func TestMetricsExposition(t *testing.T) {
+	ctx := newTestContext(t)
+	AddCounter(ctx, "gsh_test_total", "Test counter", 1, Map[string, string]{"result": "success"})
+	AddCounter(ctx, "gsh_test_total", "Test counter", 2, Map[string, string]{"result": "success"})
+	AddCounter(ctx, "gsh_test_total", "Test counter", 1, Map[string, string]{"result": "failure", "app": "123"})
+	SetGauge(ctx, "gsh_test_players", "Test gauge", 4, nil)
+	SetGauge(ctx, "gsh_test_players", "Test gauge", 2.5, nil)
+	ObserveDuration(ctx, "gsh_test_duration_seconds", "Test summary", 1500*time.Millisecond, nil)
+	ObserveDuration(ctx, "gsh_test_duration_seconds", "Test summary", 500*time.Millisecond, nil)
+	AddCounter(ctx, "gsh_test_escaped_total", "Test escaping", 1, Map[string, string]{"path": "C:\\\"a\"\nb"})
+
+	expected := strings.Join([]string{
+		"# HELP gsh_server_cpu_seconds_total CPU time (user + system) consumed by game server processes",
+		"# TYPE gsh_server_cpu_seconds_total counter",
+		"gsh_server_cpu_seconds_total 0",
+		"# HELP gsh_server_memory_bytes Resident memory of the game server process",
+		"# TYPE gsh_server_memory_bytes gauge",
+		"gsh_server_memory_bytes 0",
+		"# HELP gsh_server_up Whether the game server process is running",
+		"# TYPE gsh_server_up gauge",
+		"gsh_server_up 0",
+		"# HELP gsh_server_uptime_seconds Seconds since the game server process was started",
+		"# TYPE gsh_server_uptime_seconds gauge",
+		"gsh_server_uptime_seconds 0",
+		"# HELP gsh_test_duration_seconds Test summary",
+		"# TYPE gsh_test_duration_seconds summary",
+		"gsh_test_duration_seconds_sum 2",
+		"gsh_test_duration_seconds_count 2",
+		"# HELP gsh_test_escaped_total Test escaping",
+		"# TYPE gsh_test_escaped_total counter",
+		`gsh_test_escaped_total{path="C:\\\"a\"\nb"} 1`,
+		"# HELP gsh_test_players Test gauge",
+		"# TYPE gsh_test_players gauge",
+		"gsh_test_players 2.5",
+		"# HELP gsh_test_total Test counter",
+		"# TYPE gsh_test_total counter",
+		`gsh_test_total{app="123",result="failure"} 1`,
+		`gsh_test_total{result="success"} 3`,
+		"",
+	}, "\n")
+	actual := writeTestMetrics(t, Metrics(ctx))
+	if actual != expected {
+		t.Fatalf("exposition:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
+
+func TestMetricsServerProcess(t *testing.T) {
+	registry := newMetrics()
+
+	// the test process stands in for the game server
+	registry.setServerPid(os.Getpid())
+	output := writeTestMetrics(t, registry)
+	if !strings.Contains(output, "gsh_server_up 1\n") {
+		t.Fatalf("server not reported up:\n%s", output)
+	}
+	if strings.Contains(output, "gsh_server_memory_bytes 0\n") {
+		t.Fatalf("server memory not reported:\n%s", output)
+	}
+
+	// cpu time is carried over across restarts - the counter never decreases
+	registry.lock.Lock()
+	registry.serverCpu = 5
+	registry.lock.Unlock()
+	registry.setServerPid(0)
+	output = writeTestMetrics(t, registry)
+	if !strings.Contains(output, "gsh_server_up 0\n") || !strings.Contains(output, "gsh_server_cpu_seconds_total 5\n") {
+		t.Fatalf("stopped server not reported:\n%s", output)
+	}
+	registry.setServerPid(os.Getpid())
+	registry.lock.Lock()
+	registry.serverCpu = 1
+	registry.lock.Unlock()
+	output = writeTestMetrics(t, registry)
+	for _, line := range strings.Split(output, "\n") {
+		value, ok := strings.CutPrefix(line, "gsh_server_cpu_seconds_total ")
+		if !ok {
+			continue
+		}
+		cpu, err := strconv.ParseFloat(value, 64)
+		if err != nil || cpu < 6 {
+			t.Fatalf("cpu time %s not accumulated across restarts", value)
+		}
+	}
+}
@@ -1,96 +1,189 @@
 package helper
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
+	"slices"
 	"strings"
+	"sync"
 
-	"github.com/caarlos0/env/v11"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
 )
 
-// Parses environment variables into the provided struct pointer.
+// Parses environment variables into the provided struct pointer and validates the result against its 'validate' struct tags (see: [ValidateConfig]).
+// Unset variables are read from the file named by a '<VAR>_FILE' variable, or (for secret fields - i.e., `secret:"true"`) from a file named '<VAR>' (or '<var>') within the secrets directory (see: [SecretsDir]).
+// The values of fields tagged `secret:"true"` (including values read from files) are redacted from log output (see: [RegisterSecret]).
+// Returns [ValidationErrors] listing every unparseable or invalid variable.
 // Returns an error if parsing the environment variables fail.
-// See: [env.Parse]
+// Returns an error if a '<VAR>_FILE' variable references an unreadable file.
 func ParseEnv(ctx context.Context, cfg any) error {
 	Logger(ctx).Info("parse env", "type", fmt.Sprintf("%T", cfg))
-	return env.Parse(cfg)
+	return parseAndValidateConfig(cfg, Secrets(ctx), SecretsDir(ctx))
 }
 
-// Marshals data into the given file
-// Returns an error if marshalling fails.
+// fileFormatMarshalCb encodes data into a file format.  Existing holds the file's current contents (nil if the file does not exist) - allowing formats to preserve comments and unknown keys.
+type fileFormatMarshalCb func(data any, existing []byte) ([]byte, error)
+
+// fileFormatUnmarshalCb decodes a file format into the provided pointer
+type fileFormatUnmarshalCb func(data []byte, to any) error
+
+// FileFormat is a codec used by [MarshalFile] and [UnmarshalFile] for files with any of the given extensions (e.g., '.json')
+type FileFormat struct {
+	Extensions []string
+	Marshal    fileFormatMarshalCb
+	Unmarshal  fileFormatUnmarshalCb
+}
+
+var (
+	// fileFormats are the registered file formats (by name)
+	fileFormats = Map[string, FileFormat]{
+		"ini":        {Extensions: []string{".ini"}, Marshal: marshalIni, Unmarshal: unmarshalIni},
+		"json":       {Extensions: []string{".json"}, Marshal: marshalJson, Unmarshal: json.Unmarshal},
+		"properties": {Extensions: []string{".properties"}, Marshal: marshalProperties, Unmarshal: unmarshalProperties},
+		"toml":       {Extensions: []string{".toml"}, Marshal: marshalToml, Unmarshal: toml.Unmarshal},
+		"xml":        {Extensions: []string{".xml"}, Marshal: marshalXml, Unmarshal: xml.Unmarshal},
+		"yaml":       {Extensions: []string{".yaml", ".yml"}, Marshal: marshalYaml, Unmarshal: yaml.Unmarshal},
+	}
+	// fileFormatsLock guards access to [fileFormats]
+	fileFormatsLock sync.RWMutex
+)
+
+// Registers a file format by name - replacing any existing format with the same name.
+// Returns an error if the format is missing a marshal or unmarshal callback.
+func RegisterFileFormat(name string, format FileFormat) error {
+	if format.Marshal == nil || format.Unmarshal == nil {
+		return fmt.Errorf("file format %s requires marshal and unmarshal callbacks", name)
+	}
+	fileFormatsLock.Lock()
+	defer fileFormatsLock.Unlock()
+	fileFormats[name] = format
+	return nil
+}
+
+// Looks up a file format by name.
+// Returns an error if the format is not registered.
+func getFileFormat(name string) (FileFormat, error) {
+	fileFormatsLock.RLock()
+	defer fileFormatsLock.RUnlock()
+	format, ok := fileFormats[name]
+	if !ok {
+		return FileFormat{}, fmt.Errorf("unrecognized file format %s", name)
+	}
+	return format, nil
+}
+
+// Determines the name of a file's format from its extension - preferring the longest matching extension.
 // Returns an error if the file type is not recognized.
-func MarshalFile(ctx context.Context, data any, file string) error {
-	Logger(ctx).Info("marshal file", "path", file)
-	if strings.HasSuffix(file, ".json") {
-		return marshalJsonFile(ctx, data, file)
-	} else if strings.HasSuffix(file, ".xml") {
-		return marshalXmlFile(ctx, data, file)
-	} else {
-		return fmt.Errorf("unrecognized file type %s", file)
+func detectFileFormat(file string) (string, error) {
+	fileFormatsLock.RLock()
+	defer fileFormatsLock.RUnlock()
+	names := fileFormats.Keys()
+	slices.Sort(names)
+	match := ""
+	matchLength := 0
+	for _, name := range names {
+		for _, extension := range fileFormats[name].Extensions {
+			if strings.HasSuffix(strings.ToLower(file), strings.ToLower(extension)) && len(extension) > matchLength {
+				match = name
+				matchLength = len(extension)
+			}
+		}
 	}
+	if match == "" {
+		return "", fmt.Errorf("unrecognized file type %s", file)
+	}
+	return match, nil
+}
+
+// Marshals data into JSON
+func marshalJson(data any, existing []byte) ([]byte, error) {
+	return json.Marshal(data)
+}
+
+// Marshals data into TOML
+func marshalToml(data any, existing []byte) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	err := toml.NewEncoder(&buffer).Encode(data)
+	return buffer.Bytes(), err
+}
+
+// Marshals data into XML
+func marshalXml(data any, existing []byte) ([]byte, error) {
+	return xml.Marshal(data)
+}
+
+// Marshals data into YAML
+func marshalYaml(data any, existing []byte) ([]byte, error) {
+	return yaml.Marshal(data)
 }
 
-// Marshals data into JSON and writes it to the given file.
-// Returns an error if the data could not be JSON encoded.
-// Returns an error if the file is not writeable
-func marshalJsonFile(ctx context.Context, data any, file string) error {
-	dataBytes, err := json.Marshal(data)
+// Marshals data into the given file - using the format registered for the file's extension (see: [RegisterFileFormat]).
+// Returns an error if marshalling fails.
+// Returns an error if the file type is not recognized.
+func MarshalFile(ctx context.Context, data any, file string) error {
+	format, err := detectFileFormat(file)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(file, dataBytes, 0755)
+	return MarshalFileAs(ctx, data, file, format)
 }
 
-// Marshals data into XML and writes it to the given file.
-// Returns an error if the data could not be XML encoded.
-// Returns an error if the file is not writeable
-func marshalXmlFile(ctx context.Context, data any, file string) error {
-	dataBytes, err := xml.Marshal(data)
+// Marshals data into the given file using an explicit (registered) format - regardless of the file's extension.
+// Existing files are written in place (following symlinks and retaining their mode and owner).
+// Returns an error if the format is not registered.
+// Returns an error if the existing file is unreadable.
+// Returns an error if marshalling fails.
+func MarshalFileAs(ctx context.Context, data any, file string, format string) error {
+	Logger(ctx).Info("marshal file", "path", file, "format", format)
+	codec, err := getFileFormat(format)
+	if err != nil {
+		return err
+	}
+	existing, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	dataBytes, err := codec.Marshal(data, existing)
 	if err != nil {
 		return err
 	}
 	return os.WriteFile(file, dataBytes, 0755)
 }
 
-// Unmarshals a file into the provided struct pointer.
+// Unmarshals a file into the provided struct pointer - using the format registered for the file's extension (see: [RegisterFileFormat]).
 // Returns an error if unmarshalling fails.
 // Returns an error if the file type is not recognized.
 func UnmarshalFile(ctx context.Context, file string, data any) error {
-	if reflect.ValueOf(data).Kind() != reflect.Ptr {
-		return fmt.Errorf("data must be pointer")
-	}
-	Logger(ctx).Info("unmarshal file", "path", file)
-	if strings.HasSuffix(file, ".json") {
-		return unmarshalJsonFile(ctx, file, data)
-	} else if strings.HasSuffix(file, ".xml") {
-		return unmarshalXmlFile(ctx, file, data)
-	} else {
-		return fmt.Errorf("unrecognized file type %s", file)
+	format, err := detectFileFormat(file)
+	if err != nil {
+		return err
 	}
+	return UnmarshalFileAs(ctx, file, data, format)
 }
 
-// Unmarshals a JSON file into the provided struct pointer.
+// Unmarshals a file into the provided struct pointer using an explicit (registered) format - regardless of the file's extension.
+// Returns an error if the format is not registered.
 // Returns an error if the file is unreadable.
-// Returns an error if the file's contents is not JSON encoded.
-func unmarshalJsonFile(ctx context.Context, file string, data any) error {
-	fileBytes, err := os.ReadFile(file)
+// Returns an error if unmarshalling fails.
+func UnmarshalFileAs(ctx context.Context, file string, data any, format string) error {
+	if reflect.ValueOf(data).Kind() != reflect.Ptr {
+		return fmt.Errorf("data must be pointer")
+	}
+	Logger(ctx).Info("unmarshal file", "path", file, "format", format)
+	codec, err := getFileFormat(format)
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(fileBytes, data)
-}
-
-// Unmarshals an XML file into the provided struct pointer.
-// Returns an error if the file is unreadable.
-// Returns an error if the file's contents is not XML encoded.
-func unmarshalXmlFile(ctx context.Context, file string, data any) error {
 	fileBytes, err := os.ReadFile(file)
 	if err != nil {
 		return err
 	}
-	return xml.Unmarshal(fileBytes, data)
+	return codec.Unmarshal(fileBytes, data)
 }
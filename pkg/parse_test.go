@@ -0,0 +1,251 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarshalFileInPlace(t *testing.T) {
+	ctx := newTestContext(t)
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.json")
+	err := os.WriteFile(target, []byte(`{}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.json")
+	err = os.Symlink(target, link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = MarshalFile(ctx, map[string]any{"key": "value"}, link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lstat, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lstat.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("symlink replaced by a regular file")
+	}
+	stat, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode().Perm() != 0600 {
+		t.Fatalf("mode changed to %s", stat.Mode().Perm())
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"key":"value"}` {
+		t.Fatalf("target holds %q", data)
+	}
+}
+
+// testFileConfig is a config exercised by every built-in file format
+type testFileConfig struct {
+	Enabled bool     `json:"enabled" properties:"enabled" toml:"enabled" yaml:"enabled"`
+	Name    string   `json:"name" properties:"name" toml:"name" yaml:"name"`
+	Port    int      `json:"port" properties:"port" toml:"port" yaml:"port"`
+	Rate    float64  `json:"rate" properties:"rate" toml:"rate" yaml:"rate"`
+	Tags    []string `json:"tags" properties:"tags" toml:"tags" yaml:"tags"`
+}
+
+func TestFileFormatRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		expected []string
+	}{
+		{name: "json", file: "config.json", expected: []string{`"name":"my server"`, `"port":27015`}},
+		{name: "properties", file: "server.properties", expected: []string{"name=my server\n", "port=27015\n", "tags=pvp,hardcore\n"}},
+		{name: "toml", file: "config.toml", expected: []string{`name = "my server"`, "port = 27015", `tags = ["pvp", "hardcore"]`}},
+		{name: "yaml", file: "config.yaml", expected: []string{"name: my server\n", "port: 27015\n", "  - pvp\n"}},
+		{name: "yml", file: "config.yml", expected: []string{"name: my server\n"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(t)
+			file := filepath.Join(t.TempDir(), test.file)
+			original := testFileConfig{Enabled: true, Name: "my server", Port: 27015, Rate: 1.5, Tags: []string{"pvp", "hardcore"}}
+			err := MarshalFile(ctx, original, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, expected := range test.expected {
+				if !strings.Contains(string(data), expected) {
+					t.Fatalf("%s does not contain %q:\n%s", test.file, expected, data)
+				}
+			}
+			decoded := testFileConfig{}
+			err = UnmarshalFile(ctx, file, &decoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, original) {
+				t.Fatalf("decoded %+v (expected %+v)", decoded, original)
+			}
+		})
+	}
+}
+
+func TestFileFormatDecodeErrors(t *testing.T) {
+	tests := []struct {
+		file string
+		data string
+	}{
+		{file: "config.json", data: `{"port": "abc"}`},
+		{file: "server.properties", data: "port=abc\n"},
+		{file: "config.toml", data: "port = \"abc\"\n"},
+		{file: "config.yaml", data: "port: abc\n"},
+		{file: "config.toml", data: "name = \n"},
+		{file: "config.yaml", data: "name: [\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), test.file)
+			err := os.WriteFile(file, []byte(test.data), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = UnmarshalFile(newTestContext(t), file, &testFileConfig{})
+			if err == nil {
+				t.Fatalf("expected error decoding %q", test.data)
+			}
+		})
+	}
+}
+
+func TestDetectFileFormat(t *testing.T) {
+	tests := []struct {
+		file      string
+		expected  string
+		expectErr bool
+	}{
+		{file: "settings.ini", expected: "ini"},
+		{file: "config.json", expected: "json"},
+		{file: "server.properties", expected: "properties"},
+		{file: "config.toml", expected: "toml"},
+		{file: "serverconfig.xml", expected: "xml"},
+		{file: "config.yaml", expected: "yaml"},
+		{file: "CONFIG.YML", expected: "yaml"},
+		{file: "/path.json/config.txt", expectErr: true},
+		{file: "config", expectErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			format, err := detectFileFormat(test.file)
+			if test.expectErr {
+				if err == nil {
+					t.Fatalf("detected %s", format)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != test.expected {
+				t.Fatalf("detected %s (expected %s)", format, test.expected)
+			}
+		})
+	}
+}
+
+// Registers a file format for the duration of a test
+func registerTestFileFormat(t *testing.T, name string, format FileFormat) {
+	t.Helper()
+	err := RegisterFileFormat(name, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		fileFormatsLock.Lock()
+		defer fileFormatsLock.Unlock()
+		delete(fileFormats, name)
+	})
+}
+
+func TestRegisterFileFormat(t *testing.T) {
+	ctx := newTestContext(t)
+	lines := FileFormat{
+		Extensions: []string{".lines.txt"},
+		Marshal: func(data any, existing []byte) ([]byte, error) {
+			return []byte(strings.Join(data.([]string), "\n")), nil
+		},
+		Unmarshal: func(data []byte, to any) error {
+			*(to.(*[]string)) = strings.Split(string(data), "\n")
+			return nil
+		},
+	}
+	text := FileFormat{
+		Extensions: []string{".txt"},
+		Marshal: func(data any, existing []byte) ([]byte, error) {
+			return []byte(data.(string)), nil
+		},
+		Unmarshal: func(data []byte, to any) error {
+			*(to.(*string)) = string(data)
+			return nil
+		},
+	}
+	registerTestFileFormat(t, "test-lines", lines)
+	registerTestFileFormat(t, "test-text", text)
+
+	// the longest matching extension wins
+	dir := t.TempDir()
+	file := filepath.Join(dir, "players.lines.txt")
+	err := MarshalFile(ctx, []string{"alice", "bob"}, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := []string{}
+	err = UnmarshalFile(ctx, file, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, []string{"alice", "bob"}) {
+		t.Fatalf("decoded %v", decoded)
+	}
+	format, err := detectFileFormat(filepath.Join(dir, "motd.txt"))
+	if err != nil || format != "test-text" {
+		t.Fatalf("detected %s (error %v)", format, err)
+	}
+
+	// explicit formats ignore the file's extension
+	file = filepath.Join(dir, "motd.cfg")
+	err = MarshalFileAs(ctx, "welcome", file, "test-text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	motd := ""
+	err = UnmarshalFileAs(ctx, file, &motd, "test-text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if motd != "welcome" {
+		t.Fatalf("decoded %q", motd)
+	}
+
+	err = MarshalFileAs(ctx, "welcome", file, "unregistered")
+	if err == nil {
+		t.Fatal("expected error marshalling unregistered format")
+	}
+	err = RegisterFileFormat("incomplete", FileFormat{Extensions: []string{".incomplete"}, Unmarshal: text.Unmarshal})
+	if err == nil {
+		t.Fatal("expected error registering format without marshal callback")
+	}
+	_, err = getFileFormat("incomplete")
+	if err == nil {
+		t.Fatal("incomplete format registered")
+	}
+}
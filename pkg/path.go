@@ -2,8 +2,12 @@ package helper
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"syscall"
@@ -87,6 +91,55 @@ func GetPathSize(ctx context.Context, path string) (int, error) {
 	return size, nil
 }
 
+// Computes a sha256 digest (hex-encoded) of the content at the provided path.
+// For directories, the digest covers the relative path, type, permissions and content (or link target) of every subpath.
+// Returns an error if any subpath cannot be read.
+func hashPath(ctx context.Context, path string) (string, error) {
+	fail := func(err error) (string, error) {
+		return "", err
+	}
+	hash := sha256.New()
+	err := filepath.WalkDir(path, func(subpath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		relpath, err := filepath.Rel(path, subpath)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\x00%s\x00", filepath.ToSlash(relpath), info.Mode().String())
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(subpath)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "%s\x00", link)
+		case info.Mode().IsRegular():
+			handle, err := os.Open(subpath)
+			if err != nil {
+				return err
+			}
+			defer handle.Close()
+			fileHash := sha256.New()
+			_, err = io.Copy(fileHash, handle)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "%x\x00", fileHash.Sum(nil))
+		}
+		return nil
+	})
+	if err != nil {
+		return fail(err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 // Lists the subpaths in the given directory
 // Returns an error if the path is not a directory
 func ListDir(ctx context.Context, path string) ([]string, error) {
@@ -143,6 +196,33 @@ func SetOwnerForPaths(ctx context.Context, owner User, paths ...string) error {
 	return nil
 }
 
+// Atomically writes data to a file by writing a temporary file alongside it and renaming it into place.
+// Readers never observe a partially written file.
+// Returns an error if the temporary file cannot be written or renamed.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	handle, err := os.CreateTemp(filepath.Dir(path), fmt.Sprintf(".%s.*.tmp", filepath.Base(path)))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(handle.Name())
+	_, err = handle.Write(data)
+	if err == nil {
+		err = handle.Sync()
+	}
+	closeErr := handle.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	err = os.Chmod(handle.Name(), perm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(handle.Name(), path)
+}
+
 // Creates a symlink from one path to another path.
 // Returns an error if the symlink operation fails.
 func SymlinkDir(ctx context.Context, from string, to string) error {
@@ -0,0 +1,341 @@
+package helper
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// propertiesLine is a single logical line of a .properties file (continuation lines are joined).
+// Entries retain their original text (raw) and key/separator (prefix) so that unchanged entries are written back verbatim.
+type propertiesLine struct {
+	key    string
+	prefix string
+	raw    string
+	value  string
+}
+
+// propertiesDocument is a parsed .properties file that preserves comments, blank lines and entry order
+type propertiesDocument struct {
+	lines   []*propertiesLine
+	newline string
+}
+
+// Parses .properties data into a document
+func parseProperties(data []byte) *propertiesDocument {
+	text := string(data)
+	doc := &propertiesDocument{newline: "\n"}
+	if strings.Contains(text, "\r\n") {
+		doc.newline = "\r\n"
+	}
+	text = strings.TrimSuffix(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if text == "" {
+		return doc
+	}
+	physical := strings.Split(text, "\n")
+	for index := 0; index < len(physical); index++ {
+		raw := physical[index]
+		trimmed := strings.TrimLeft(raw, " \t\f")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "!") {
+			doc.lines = append(doc.lines, &propertiesLine{raw: raw})
+			continue
+		}
+		indent := raw[:len(raw)-len(trimmed)]
+		logical := trimmed
+		for isPropertiesContinued(logical) && index+1 < len(physical) {
+			index++
+			raw += "\n" + physical[index]
+			logical = logical[:len(logical)-1] + strings.TrimLeft(physical[index], " \t\f")
+		}
+		logical = strings.TrimSuffix(logical, `\`)
+		end := len(logical)
+		for position := 0; position < len(logical); position++ {
+			if logical[position] == '\\' {
+				position++
+				continue
+			}
+			if strings.ContainsRune("=: \t\f", rune(logical[position])) {
+				end = position
+				break
+			}
+		}
+		separator := end
+		for separator < len(logical) && strings.ContainsRune(" \t\f", rune(logical[separator])) {
+			separator++
+		}
+		if separator < len(logical) && strings.ContainsRune("=:", rune(logical[separator])) {
+			separator++
+		}
+		for separator < len(logical) && strings.ContainsRune(" \t\f", rune(logical[separator])) {
+			separator++
+		}
+		prefix := indent + logical[:separator]
+		if separator == end {
+			prefix += "="
+		}
+		doc.lines = append(doc.lines, &propertiesLine{
+			key:    unescapeProperties(logical[:end]),
+			prefix: prefix,
+			raw:    raw,
+			value:  unescapeProperties(logical[separator:]),
+		})
+	}
+	return doc
+}
+
+// Returns true if a line ends with an odd number of backslashes (i.e., continues onto the next line)
+func isPropertiesContinued(line string) bool {
+	count := 0
+	for index := len(line) - 1; index >= 0 && line[index] == '\\'; index-- {
+		count++
+	}
+	return count%2 == 1
+}
+
+// Unescapes a .properties key or value (e.g., '\n', '\t', '\u00e9', '\=')
+func unescapeProperties(data string) string {
+	builder := strings.Builder{}
+	for index := 0; index < len(data); index++ {
+		if data[index] != '\\' || index+1 >= len(data) {
+			builder.WriteByte(data[index])
+			continue
+		}
+		index++
+		switch data[index] {
+		case 'f':
+			builder.WriteByte('\f')
+		case 'n':
+			builder.WriteByte('\n')
+		case 'r':
+			builder.WriteByte('\r')
+		case 't':
+			builder.WriteByte('\t')
+		case 'u':
+			code, err := strconv.ParseUint(data[index+1:min(index+5, len(data))], 16, 32)
+			if err != nil || index+5 > len(data) {
+				builder.WriteString(`\u`)
+				continue
+			}
+			builder.WriteRune(rune(code))
+			index += 4
+		default:
+			builder.WriteByte(data[index])
+		}
+	}
+	return builder.String()
+}
+
+// Escapes a .properties key or value.  Keys additionally escape separators and spaces - values only escape leading spaces.
+func escapeProperties(data string, key bool) string {
+	builder := strings.Builder{}
+	for index, char := range data {
+		switch {
+		case char == '\\':
+			builder.WriteString(`\\`)
+		case char == '\f':
+			builder.WriteString(`\f`)
+		case char == '\n':
+			builder.WriteString(`\n`)
+		case char == '\r':
+			builder.WriteString(`\r`)
+		case char == '\t':
+			builder.WriteString(`\t`)
+		case char == ' ' && (key || index == 0):
+			builder.WriteString(`\ `)
+		case key && strings.ContainsRune("=:#!", char):
+			builder.WriteRune('\\')
+			builder.WriteRune(char)
+		default:
+			builder.WriteRune(char)
+		}
+	}
+	return builder.String()
+}
+
+// Serializes the document (using the document's original line endings)
+func (doc *propertiesDocument) bytes() []byte {
+	lines := []string{}
+	for _, line := range doc.lines {
+		lines = append(lines, strings.ReplaceAll(line.raw, "\n", doc.newline))
+	}
+	if len(lines) == 0 {
+		return []byte{}
+	}
+	return []byte(strings.Join(lines, doc.newline) + doc.newline)
+}
+
+// Returns the document's keys (in order of first appearance)
+func (doc *propertiesDocument) keys() []string {
+	keys := []string{}
+	for _, line := range doc.lines {
+		if line.prefix != "" && !slices.Contains(keys, line.key) {
+			keys = append(keys, line.key)
+		}
+	}
+	return keys
+}
+
+// Returns the value of a key (the last entry wins) and whether the key exists
+func (doc *propertiesDocument) value(key string) (string, bool) {
+	value := ""
+	found := false
+	for _, line := range doc.lines {
+		if line.prefix != "" && line.key == key {
+			value = line.value
+			found = true
+		}
+	}
+	return value, found
+}
+
+// Sets the value of a key - rewriting its last entry (if the value changed) or appending a new entry
+func (doc *propertiesDocument) set(key string, value string) {
+	for index := len(doc.lines) - 1; index >= 0; index-- {
+		line := doc.lines[index]
+		if line.prefix == "" || line.key != key {
+			continue
+		}
+		if line.value != value {
+			line.value = value
+			line.raw = line.prefix + escapeProperties(value, false)
+		}
+		return
+	}
+	prefix := escapeProperties(key, true) + "="
+	doc.lines = append(doc.lines, &propertiesLine{key: key, prefix: prefix, raw: prefix + escapeProperties(value, false), value: value})
+}
+
+// Formats a value as a .properties value (slices are comma-separated)
+func formatPropertiesValue(value reflect.Value, existing string, found bool) (string, error) {
+	previous := []string{}
+	if found {
+		previous = append(previous, existing)
+	}
+	values, err := formatIniValues(value, previous)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(values, ","), nil
+}
+
+// Parses a .properties value into a value (slices are comma-separated)
+func parsePropertiesValue(value reflect.Value, data string) error {
+	values := []string{data}
+	if value.Kind() == reflect.Slice {
+		values = []string{}
+		if data != "" {
+			values = strings.Split(data, ",")
+		}
+		for index := range values {
+			values[index] = strings.TrimSpace(values[index])
+		}
+	}
+	return parseIniValues(value, values)
+}
+
+// propertiesField is a struct field mapped to a .properties key via its 'properties' struct tag (e.g., `properties:"server-port,omitempty"`)
+type propertiesField struct {
+	name      string
+	omitEmpty bool
+	value     reflect.Value
+}
+
+// Returns the fields of a struct value that map to .properties keys
+func getPropertiesFields(value reflect.Value) []propertiesField {
+	fields := []propertiesField{}
+	for index := 0; index < value.NumField(); index++ {
+		field := value.Type().Field(index)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("properties"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, propertiesField{name: name, omitEmpty: options == "omitempty", value: value.Field(index)})
+	}
+	return fields
+}
+
+// Marshals data (a struct or a string-keyed map) into .properties, merging it into existing .properties data (which may be empty).
+// Comments, ordering and keys absent from data are preserved.
+// Returns an error if data is not a struct or map.
+// Returns an error if any value has an unsupported type.
+func marshalProperties(data any, existing []byte) ([]byte, error) {
+	doc := parseProperties(existing)
+	value := getIniTarget(reflect.ValueOf(data))
+	switch {
+	case value.Kind() == reflect.Map && value.Type().Key().Kind() == reflect.String:
+		keys := value.MapKeys()
+		slices.SortFunc(keys, func(a reflect.Value, b reflect.Value) int { return strings.Compare(a.String(), b.String()) })
+		for _, key := range keys {
+			current, found := doc.value(key.String())
+			formatted, err := formatPropertiesValue(value.MapIndex(key), current, found)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key.String(), err)
+			}
+			doc.set(key.String(), formatted)
+		}
+	case value.Kind() == reflect.Struct:
+		for _, field := range getPropertiesFields(value) {
+			if field.omitEmpty && field.value.IsZero() {
+				continue
+			}
+			current, found := doc.value(field.name)
+			formatted, err := formatPropertiesValue(field.value, current, found)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", field.name, err)
+			}
+			doc.set(field.name, formatted)
+		}
+	default:
+		return nil, fmt.Errorf("properties data must be a struct or string-keyed map")
+	}
+	return doc.bytes(), nil
+}
+
+// Unmarshals .properties data into a struct or string-keyed map pointer (see: [marshalProperties]).
+// Returns an error if data is not a pointer to a struct or string-keyed map.
+// Returns an error if any value cannot be coerced into its field's type.
+func unmarshalProperties(data []byte, to any) error {
+	doc := parseProperties(data)
+	value := reflect.ValueOf(to)
+	if value.Kind() != reflect.Pointer || value.IsNil() {
+		return fmt.Errorf("data must be pointer")
+	}
+	value = value.Elem()
+	switch {
+	case value.Kind() == reflect.Map && value.Type().Key().Kind() == reflect.String:
+		if value.IsNil() {
+			value.Set(reflect.MakeMap(value.Type()))
+		}
+		for _, key := range doc.keys() {
+			current, _ := doc.value(key)
+			item := reflect.New(value.Type().Elem()).Elem()
+			err := parsePropertiesValue(item, current)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			value.SetMapIndex(reflect.ValueOf(key).Convert(value.Type().Key()), item)
+		}
+	case value.Kind() == reflect.Struct:
+		for _, field := range getPropertiesFields(value) {
+			current, found := doc.value(field.name)
+			if !found {
+				continue
+			}
+			err := parsePropertiesValue(field.value, current)
+			if err != nil {
+				return fmt.Errorf("%s: %w", field.name, err)
+			}
+		}
+	default:
+		return fmt.Errorf("properties data must be a struct or string-keyed map")
+	}
+	return nil
+}
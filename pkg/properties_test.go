@@ -0,0 +1,134 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMarshalProperties(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		data     any
+		expected string
+	}{
+		{
+			name:     "new file",
+			data:     map[string]any{"server-port": 25565, "motd": "A Minecraft Server"},
+			expected: "motd=A Minecraft Server\nserver-port=25565\n",
+		},
+		{
+			name:     "preserves comments, order and unknown keys",
+			existing: "#Minecraft server properties\n! generated\n\nserver-port = 25565\nlevel-name: world\n",
+			data:     map[string]any{"server-port": 25566, "pvp": true},
+			expected: "#Minecraft server properties\n! generated\n\nserver-port = 25566\nlevel-name: world\npvp=true\n",
+		},
+		{
+			name:     "unchanged entries are kept verbatim",
+			existing: "motd   A\\u0020Server\nlevel-name=world\n",
+			data:     map[string]any{"motd": "A Server"},
+			expected: "motd   A\\u0020Server\nlevel-name=world\n",
+		},
+		{
+			name:     "last duplicate entry is rewritten",
+			existing: "motd=first\nmotd=second\n",
+			data:     map[string]any{"motd": "third"},
+			expected: "motd=first\nmotd=third\n",
+		},
+		{
+			name:     "continuation lines",
+			existing: "motd=Hello \\\n    World\nlevel-name=world\n",
+			data:     map[string]any{"motd": "Goodbye"},
+			expected: "motd=Goodbye\nlevel-name=world\n",
+		},
+		{
+			name:     "windows line endings",
+			existing: "# comment\r\nmotd=old\r\n",
+			data:     map[string]any{"motd": "new", "pvp": false},
+			expected: "# comment\r\nmotd=new\r\npvp=false\r\n",
+		},
+		{
+			name:     "escapes keys and values",
+			data:     map[string]any{"key with:separators=": "  leading spaces\ttab\\"},
+			expected: "key\\ with\\:separators\\==\\  leading spaces\\ttab\\\\\n",
+		},
+		{
+			name: "struct with omitempty",
+			data: struct {
+				Motd string   `properties:"motd,omitempty"`
+				Port int      `properties:"server-port"`
+				Ops  []string `properties:"ops"`
+				Skip string   `properties:"-"`
+			}{Port: 25565, Ops: []string{"alice", "bob"}, Skip: "skipped"},
+			expected: "server-port=25565\nops=alice,bob\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := marshalProperties(test.data, []byte(test.existing))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(actual) != test.expected {
+				t.Fatalf("marshalled %q (expected %q)", actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestMarshalPropertiesInvalidData(t *testing.T) {
+	for _, data := range []any{"value", []string{"a"}, map[int]string{1: "a"}} {
+		_, err := marshalProperties(data, nil)
+		if err == nil {
+			t.Fatalf("expected error marshalling %T", data)
+		}
+	}
+}
+
+func TestUnmarshalProperties(t *testing.T) {
+	data := "# comment\n" +
+		"server-port = 25565\n" +
+		"motd: Hello \\\n    World\n" +
+		"key\\ with\\:separators\\==value\n" +
+		"unicode=caf\\u00e9\n" +
+		"empty\n" +
+		"ops=alice, bob\n" +
+		"pvp=true\n"
+
+	decoded := map[string]string{}
+	err := unmarshalProperties([]byte(data), &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"empty":                "",
+		"key with:separators=": "value",
+		"motd":                 "Hello World",
+		"ops":                  "alice, bob",
+		"pvp":                  "true",
+		"server-port":          "25565",
+		"unicode":              "café",
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Fatalf("decoded %q (expected %q)", decoded, expected)
+	}
+
+	config := struct {
+		Missing string   `properties:"missing"`
+		Ops     []string `properties:"ops"`
+		Port    int      `properties:"server-port"`
+		Pvp     bool     `properties:"pvp"`
+	}{Missing: "default"}
+	err = unmarshalProperties([]byte(data), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Missing != "default" || config.Port != 25565 || !config.Pvp || !reflect.DeepEqual(config.Ops, []string{"alice", "bob"}) {
+		t.Fatalf("decoded %+v", config)
+	}
+
+	err = unmarshalProperties([]byte(data), decoded)
+	if err == nil {
+		t.Fatal("expected error unmarshalling into non-pointer")
+	}
+}
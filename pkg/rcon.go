@@ -0,0 +1,248 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rcon packet types (see: https://developer.valvesoftware.com/wiki/Source_RCON_Protocol)
+const (
+	rconTypeAuth         int32 = 3
+	rconTypeAuthResponse int32 = 2
+	rconTypeExecCommand  int32 = 2
+	rconTypeResponse     int32 = 0
+)
+
+// rconMaxPacketSize is the largest packet size accepted from a server
+const rconMaxPacketSize = 4096 + 10
+
+// rconPacket is a single packet sent to or received from an rcon server
+type rconPacket struct {
+	Body string
+	Id   int32
+	Type int32
+}
+
+// RconOpts defines the options used in conjunction with the [Rcon] function
+type RconOpts struct {
+	Address  string        `env:"RCON_ADDRESS"`
+	Password string        `env:"RCON_PASSWORD" secret:"true"`
+	Timeout  time.Duration `env:"RCON_TIMEOUT"`
+}
+
+// rconClient is a connected, authenticated client speaking the Source rcon protocol
+type rconClient struct {
+	conn    net.Conn
+	ctx     context.Context
+	lastId  int32
+	lock    sync.Mutex
+	stop    func() bool
+	timeout time.Duration
+}
+
+// Closes the connection to the rcon server
+func (c *rconClient) Close() error {
+	c.stop()
+	return c.conn.Close()
+}
+
+// Executes a console command and returns its output.
+// Multi-packet responses are reassembled by following the command with an empty response packet - servers mirror this packet once the command's response has been fully sent.
+// Returns an error if the command cannot be sent or if the response cannot be read.
+func (c *rconClient) Exec(command string) (string, error) {
+	fail := func(err error) (string, error) {
+		return "", err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	Logger(c.ctx).Info("rcon exec", "command", command)
+	commandId := c.nextId()
+	err := c.write(rconPacket{Body: command, Id: commandId, Type: rconTypeExecCommand})
+	if err != nil {
+		return fail(err)
+	}
+	terminatorId := c.nextId()
+	err = c.write(rconPacket{Id: terminatorId, Type: rconTypeResponse})
+	if err != nil {
+		return fail(err)
+	}
+
+	output := strings.Builder{}
+	for {
+		packet, err := c.read()
+		if err != nil {
+			return fail(err)
+		}
+		if packet.Id == terminatorId {
+			break
+		}
+		if packet.Id != commandId || packet.Type != rconTypeResponse {
+			continue
+		}
+		output.WriteString(packet.Body)
+	}
+	return output.String(), nil
+}
+
+// Authenticates the client with the given password.
+// Returns an error if the server rejects the password.
+func (c *rconClient) auth(password string) error {
+	authId := c.nextId()
+	err := c.write(rconPacket{Body: password, Id: authId, Type: rconTypeAuth})
+	if err != nil {
+		return err
+	}
+	for {
+		packet, err := c.read()
+		if err != nil {
+			return err
+		}
+		if packet.Type != rconTypeAuthResponse {
+			continue
+		}
+		if packet.Id == -1 {
+			return fmt.Errorf("rcon authentication failed")
+		}
+		if packet.Id != authId {
+			return fmt.Errorf("rcon auth response id mismatch (%d != %d)", packet.Id, authId)
+		}
+		return nil
+	}
+}
+
+// Returns the deadline for a network operation - the earlier of the context deadline and the client timeout.
+func (c *rconClient) deadline() time.Time {
+	deadline := time.Now().Add(c.timeout)
+	ctxDeadline, ok := c.ctx.Deadline()
+	if ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	return deadline
+}
+
+// Returns a new packet id
+func (c *rconClient) nextId() int32 {
+	c.lastId += 1
+	return c.lastId
+}
+
+// Reads a single packet from the connection.
+// Returns an error if the read fails or times out.
+// Returns an error if the packet is malformed.
+func (c *rconClient) read() (rconPacket, error) {
+	fail := func(err error) (rconPacket, error) {
+		return rconPacket{}, err
+	}
+
+	err := c.conn.SetReadDeadline(c.deadline())
+	if err != nil {
+		return fail(err)
+	}
+	var size int32
+	err = binary.Read(c.conn, binary.LittleEndian, &size)
+	if err != nil {
+		return fail(err)
+	}
+	if size < 10 || size > rconMaxPacketSize {
+		return fail(fmt.Errorf("rcon packet size invalid %d", size))
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(c.conn, data)
+	if err != nil {
+		return fail(err)
+	}
+	packet := rconPacket{
+		Id:   int32(binary.LittleEndian.Uint32(data[0:4])),
+		Type: int32(binary.LittleEndian.Uint32(data[4:8])),
+	}
+	body := data[8:]
+	end := bytes.IndexByte(body, 0)
+	if end == -1 {
+		return fail(fmt.Errorf("rcon packet body unterminated"))
+	}
+	packet.Body = string(body[:end])
+	return packet, nil
+}
+
+// Writes a single packet to the connection.
+// Returns an error if the write fails or times out.
+func (c *rconClient) write(packet rconPacket) error {
+	err := c.conn.SetWriteDeadline(c.deadline())
+	if err != nil {
+		return err
+	}
+	buffer := bytes.Buffer{}
+	binary.Write(&buffer, binary.LittleEndian, int32(len(packet.Body)+10))
+	binary.Write(&buffer, binary.LittleEndian, packet.Id)
+	binary.Write(&buffer, binary.LittleEndian, packet.Type)
+	buffer.WriteString(packet.Body)
+	buffer.Write([]byte{0, 0})
+	_, err = c.conn.Write(buffer.Bytes())
+	return err
+}
+
+// Connects and authenticates to a Source rcon server.
+// Network operations are bound by both the provided context and the configured timeout (default: 10s).
+// The caller is responsible for closing the returned client.
+// Returns an error if the connection fails.
+// Returns an error if authentication fails.
+func Rcon(ctx context.Context, opts RconOpts) (*rconClient, error) {
+	fail := func(err error) (*rconClient, error) {
+		return nil, err
+	}
+
+	if opts.Address == "" {
+		return fail(fmt.Errorf("rcon address unset"))
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	Logger(ctx).Info("rcon connect", "address", opts.Address)
+	return rconConnect(ctx, opts)
+}
+
+// Connects to (and authenticates with) an rcon server without logging - allowing callers that connect repeatedly (e.g., readiness checks) to limit their log output.
+// Returns an error if the connection fails.
+// Returns an error if authentication fails.
+func rconConnect(ctx context.Context, opts RconOpts) (*rconClient, error) {
+	fail := func(err error) (*rconClient, error) {
+		return nil, err
+	}
+
+	dialer := net.Dialer{Timeout: opts.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", opts.Address)
+	if err != nil {
+		return fail(err)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	client := &rconClient{conn: conn, ctx: ctx, stop: stop, timeout: opts.Timeout}
+	err = client.auth(opts.Password)
+	if err != nil {
+		client.Close()
+		return fail(err)
+	}
+	return client, nil
+}
+
+// Connects to the rcon server configured by the entrypoint (see: [RconConfig]), executes a console command and then disconnects.
+// Returns an error if any part of this process fails.
+func RconExec(ctx context.Context, command string) (string, error) {
+	client, err := Rcon(ctx, RconConfig(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	return client.Exec(command)
+}
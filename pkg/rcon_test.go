@@ -0,0 +1,150 @@
+package helper
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRconServer is a loopback Source rcon server used to exercise the rcon client
+type fakeRconServer struct {
+	listener net.Listener
+	password string
+	// responses maps commands to the packet bodies sent in response (one packet per body) - the server hangs upon receiving any other command
+	responses map[string][]string
+}
+
+// Starts a fake rcon server on a loopback port - the server stops when the test completes
+func startFakeRconServer(t *testing.T, password string, responses map[string][]string) *fakeRconServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeRconServer{listener: listener, password: password, responses: responses}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+// Serves a single connection - reusing the client's packet framing
+func (s *fakeRconServer) serve(conn net.Conn) {
+	defer conn.Close()
+	peer := &rconClient{conn: conn, ctx: context.Background(), timeout: 10 * time.Second}
+	for {
+		packet, err := peer.read()
+		if err != nil {
+			return
+		}
+		switch packet.Type {
+		case rconTypeAuth:
+			// source servers send an empty response value prior to the auth response
+			peer.write(rconPacket{Id: packet.Id, Type: rconTypeResponse})
+			id := packet.Id
+			if packet.Body != s.password {
+				id = -1
+			}
+			peer.write(rconPacket{Id: id, Type: rconTypeAuthResponse})
+		case rconTypeExecCommand:
+			bodies, ok := s.responses[packet.Body]
+			if !ok {
+				// consume (and never answer) everything until the client disconnects
+				io.Copy(io.Discard, conn)
+				return
+			}
+			for _, body := range bodies {
+				peer.write(rconPacket{Body: body, Id: packet.Id, Type: rconTypeResponse})
+			}
+		case rconTypeResponse:
+			// mirror the terminator packet once prior responses have been sent
+			peer.write(rconPacket{Id: packet.Id, Type: rconTypeResponse})
+		}
+	}
+}
+
+func TestRconAuthFailure(t *testing.T) {
+	server := startFakeRconServer(t, "secret", nil)
+	_, err := Rcon(newTestContext(t), RconOpts{Address: server.listener.Addr().String(), Password: "wrong", Timeout: time.Second})
+	if err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Fatalf("expected authentication failure, got %v", err)
+	}
+}
+
+func TestRconExecMultiPacket(t *testing.T) {
+	first := strings.Repeat("a", 4000)
+	second := strings.Repeat("b", 4000)
+	server := startFakeRconServer(t, "secret", map[string][]string{"list": {first, second, "c"}, "status": {"ok"}})
+	client, err := Rcon(newTestContext(t), RconOpts{Address: server.listener.Addr().String(), Password: "secret", Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	output, err := client.Exec("list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != first+second+"c" {
+		t.Fatalf("unexpected output (length %d)", len(output))
+	}
+	// subsequent commands on the same connection must not observe stale packets
+	output, err = client.Exec("status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "ok" {
+		t.Fatalf("unexpected output %q", output)
+	}
+}
+
+func TestRconExecTimeout(t *testing.T) {
+	server := startFakeRconServer(t, "secret", map[string][]string{})
+	// a listener that accepts connections but never responds (i.e., authentication hangs)
+	hung, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hung.Close()
+	go func() {
+		conn, err := hung.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	start := time.Now()
+	_, err = Rcon(newTestContext(t), RconOpts{Address: hung.Addr().String(), Password: "secret", Timeout: 200 * time.Millisecond})
+	if err == nil {
+		t.Fatal("expected timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("timeout not honored (%s)", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(newTestContext(t), 200*time.Millisecond)
+	defer cancel()
+	client, err := Rcon(ctx, RconOpts{Address: server.listener.Addr().String(), Password: "secret", Timeout: 10 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	start = time.Now()
+	_, err = client.Exec("hang")
+	if err == nil {
+		t.Fatal("expected context deadline to interrupt exec")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("context deadline not honored (%s)", elapsed)
+	}
+}
@@ -0,0 +1,375 @@
+package helper
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// readinessInterval is the interval at which polled readiness checks are evaluated
+const readinessInterval = 2 * time.Second
+
+// ServerState is the lifecycle state of the game server
+type ServerState string
+
+const (
+	// ServerStateReady indicates that all readiness checks have passed
+	ServerStateReady ServerState = "ready"
+	// ServerStateStarting indicates that the server has been launched but is not yet ready
+	ServerStateStarting ServerState = "starting"
+	// ServerStateStopped indicates that the server is not running
+	ServerStateStopped ServerState = "stopped"
+	// ServerStateStopping indicates that the server is shutting down
+	ServerStateStopping ServerState = "stopping"
+)
+
+// readinessCheckCb is a callback that returns true once a readiness condition has been met
+type readinessCheckCb func(ctx context.Context) (bool, error)
+
+// ReadinessCheck is a condition that must be met before the server is considered ready.
+// A check is either polled (see: [ReadyOnFile], [ReadyOnRcon], [ReadyOnTcpPort], [ReadyOnUdpPort]) or matched against the server's output (see: [ReadyOnOutput]).
+type ReadinessCheck struct {
+	Name    string
+	check   readinessCheckCb
+	pattern string
+}
+
+// Creates a [ReadinessCheck] that passes once the given path exists
+func ReadyOnFile(path string) ReadinessCheck {
+	return ReadinessCheck{
+		Name: fmt.Sprintf("file %s", path),
+		check: func(ctx context.Context) (bool, error) {
+			_, err := os.Lstat(path)
+			if errors.Is(err, os.ErrNotExist) {
+				return false, nil
+			}
+			return err == nil, err
+		},
+	}
+}
+
+// Creates a [ReadinessCheck] that passes once a line of the server's output matches the given regular expression
+func ReadyOnOutput(pattern string) ReadinessCheck {
+	return ReadinessCheck{Name: fmt.Sprintf("output %s", pattern), pattern: pattern}
+}
+
+// Creates a [ReadinessCheck] that passes once the entrypoint's rcon server (see: [RconConfig]) accepts connections and authenticates.
+// The check is polled - connection failures are only logged when they change (rather than on every attempt).
+func ReadyOnRcon() ReadinessCheck {
+	lock := sync.Mutex{}
+	lastErr := ""
+	return ReadinessCheck{
+		Name: "rcon",
+		check: func(ctx context.Context) (bool, error) {
+			opts := RconConfig(ctx)
+			if opts.Timeout == 0 {
+				opts.Timeout = readinessInterval
+			}
+			var client *rconClient
+			err := fmt.Errorf("rcon address unset")
+			if opts.Address != "" {
+				client, err = rconConnect(ctx, opts)
+			}
+			message := ""
+			if err != nil {
+				message = err.Error()
+			}
+			lock.Lock()
+			changed := message != lastErr
+			lastErr = message
+			lock.Unlock()
+			if err != nil {
+				if changed {
+					Logger(ctx).Info("rcon not ready", "address", opts.Address, "error", message)
+				}
+				return false, nil
+			}
+			client.Close()
+			return true, nil
+		},
+	}
+}
+
+// Creates a [ReadinessCheck] that passes once the given TCP address accepts connections
+func ReadyOnTcpPort(address string) ReadinessCheck {
+	return ReadinessCheck{
+		Name: fmt.Sprintf("tcp %s", address),
+		check: func(ctx context.Context) (bool, error) {
+			dialer := net.Dialer{Timeout: readinessInterval}
+			conn, err := dialer.DialContext(ctx, "tcp", address)
+			if err != nil {
+				return false, nil
+			}
+			conn.Close()
+			return true, nil
+		},
+	}
+}
+
+// Creates a [ReadinessCheck] that passes once a local UDP socket is bound to the given port.
+// Because UDP is connectionless, bound sockets are discovered via /proc/net/udp (and /proc/net/udp6).
+func ReadyOnUdpPort(port int) ReadinessCheck {
+	return ReadinessCheck{
+		Name: fmt.Sprintf("udp %d", port),
+		check: func(ctx context.Context) (bool, error) {
+			for _, file := range []string{"/proc/net/udp", "/proc/net/udp6"} {
+				bound, err := procNetHasPort(file, port)
+				if err != nil {
+					return false, err
+				}
+				if bound {
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+	}
+}
+
+// Returns true if a socket listed within a /proc/net/{tcp,udp}[6] file is bound to the given local port
+// Returns an error if the file exists but cannot be read.
+func procNetHasPort(file string, port int) (bool, error) {
+	handle, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer handle.Close()
+	scanner := bufio.NewScanner(handle)
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		_, hexPort, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		localPort, err := strconv.ParseInt(hexPort, 16, 32)
+		if err == nil && int(localPort) == port {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// readinessStatus is the server state persisted to the status file
+type readinessStatus struct {
+	State   ServerState `json:"state"`
+	Updated time.Time   `json:"updated"`
+}
+
+// readiness tracks the game server's lifecycle state
+type readiness struct {
+	checks     []ReadinessCheck
+	generation int
+	lock       sync.Mutex
+	met        Map[int, bool]
+	patterns   Map[int, *regexp.Regexp]
+	state      ServerState
+	statusFile string
+}
+
+// Creates a new [readiness] tracker.
+// Returns an error if any output pattern is an invalid regular expression.
+func newReadiness(checks []ReadinessCheck, statusFile string) (*readiness, error) {
+	patterns := Map[int, *regexp.Regexp]{}
+	for index, check := range checks {
+		if check.pattern == "" {
+			continue
+		}
+		pattern, err := regexp.Compile(check.pattern)
+		if err != nil {
+			return nil, err
+		}
+		patterns[index] = pattern
+	}
+	return &readiness{checks: checks, met: Map[int, bool]{}, patterns: patterns, state: ServerStateStopped, statusFile: statusFile}, nil
+}
+
+// Returns true if all readiness checks have been met.  Must be called while holding the lock.
+func (r *readiness) allMet() bool {
+	return len(r.met) == len(r.checks)
+}
+
+// Marks a check as met - transitioning the server to ready if all checks have been met.  Must be called while holding the lock.
+func (r *readiness) markMet(ctx context.Context, index int) {
+	if r.met[index] {
+		return
+	}
+	Logger(ctx).Info("readiness check passed", "name", r.checks[index].Name)
+	r.met[index] = true
+	if r.state == ServerStateStarting && r.allMet() {
+		r.setStateLocked(ctx, ServerStateReady)
+	}
+}
+
+// Evaluates output-based readiness checks against a single line of the server's output
+func (r *readiness) observe(ctx context.Context, line string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.state != ServerStateStarting {
+		return
+	}
+	for index, pattern := range r.patterns {
+		if pattern.MatchString(line) {
+			r.markMet(ctx, index)
+		}
+	}
+}
+
+// Periodically evaluates polled readiness checks until they have all passed or the server is restarted/stopped
+func (r *readiness) poll(ctx context.Context, generation int) {
+	ticker := time.NewTicker(readinessInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		r.lock.Lock()
+		if r.generation != generation || r.state != ServerStateStarting {
+			r.lock.Unlock()
+			return
+		}
+		pending := Map[int, readinessCheckCb]{}
+		for index, check := range r.checks {
+			if check.check != nil && !r.met[index] {
+				pending[index] = check.check
+			}
+		}
+		r.lock.Unlock()
+		if len(pending) == 0 {
+			return
+		}
+
+		for index, check := range pending {
+			met, err := check(ctx)
+			if err != nil {
+				Logger(ctx).Warn("readiness check failed", "name", r.checks[index].Name, "error", err.Error())
+				continue
+			}
+			if !met {
+				continue
+			}
+			r.lock.Lock()
+			if r.generation == generation {
+				r.markMet(ctx, index)
+			}
+			r.lock.Unlock()
+		}
+	}
+}
+
+// Sets the server state (and persists it to the status file)
+func (r *readiness) setState(ctx context.Context, state ServerState) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.setStateLocked(ctx, state)
+}
+
+// Sets the server state (and persists it to the status file).  Must be called while holding the lock.
+func (r *readiness) setStateLocked(ctx context.Context, state ServerState) {
+	if r.state == state {
+		return
+	}
+	Logger(ctx).Info("server state changed", "from", r.state, "to", state)
+	r.state = state
+	r.persist(ctx)
+}
+
+// Persists the current server state to the status file.  Must be called while holding the lock.
+// Failures are logged rather than returned - the status file is informational.
+func (r *readiness) persist(ctx context.Context) {
+	err := writeServerStatus(r.statusFile, readinessStatus{State: r.state, Updated: time.Now()})
+	if err != nil {
+		Logger(ctx).Warn("write status file failed", "path", r.statusFile, "error", err.Error())
+	}
+}
+
+// Resets the tracker to the stopped state - overwriting any stale status file left behind by a previous run.
+func (r *readiness) reset(ctx context.Context) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.generation += 1
+	r.state = ServerStateStopped
+	r.persist(ctx)
+}
+
+// Marks the server as starting - resetting all readiness checks and polling them until the server is ready.
+func (r *readiness) start(ctx context.Context) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.generation += 1
+	r.met = Map[int, bool]{}
+	r.setStateLocked(ctx, ServerStateStarting)
+	if r.allMet() {
+		r.setStateLocked(ctx, ServerStateReady)
+		return
+	}
+	go r.poll(ctx, r.generation)
+}
+
+// Atomically writes the server status to the given file.
+// Returns an error if the status file cannot be written.
+func writeServerStatus(file string, status readinessStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(file, data, 0644)
+}
+
+// Retrieves the server state.
+// Reads the status file written by the entrypoint process - allowing other processes (e.g., the 'health' command) to inspect the server state.
+// Returns [ServerStateStopped] if the status file does not exist.
+// Returns an error if the status file is unreadable.
+func GetServerState(ctx context.Context) (ServerState, error) {
+	file := ReadinessTracker(ctx).statusFile
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return ServerStateStopped, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	status := readinessStatus{}
+	err = json.Unmarshal(data, &status)
+	if err != nil {
+		return "", err
+	}
+	return status.State, nil
+}
+
+// Sets the server state.
+// Typically unnecessary - commands launched with [CmdOpts].TrackReadiness (and supervised commands) update the server state automatically.
+func SetServerState(ctx context.Context, state ServerState) {
+	ReadinessTracker(ctx).setState(ctx, state)
+}
+
+// Checks the health of the server by confirming the server state is [ServerStateReady].
+// Returns an error if the server is not ready.
+func checkServerReady(ctx context.Context) error {
+	state, err := GetServerState(ctx)
+	if err != nil {
+		return err
+	}
+	if state != ServerStateReady {
+		return fmt.Errorf("server not ready (state: %s)", state)
+	}
+	return nil
+}
+
+// Returns the default status file path
+func defaultStatusFile() string {
+	return filepath.Join(os.TempDir(), "game-server-helper-status.json")
+}
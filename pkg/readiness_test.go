@@ -0,0 +1,200 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Creates a context holding a readiness tracker (persisting to a temporary status file) for the given checks
+func newTestReadinessContext(t *testing.T, checks ...ReadinessCheck) context.Context {
+	t.Helper()
+	tracker, err := newReadiness(checks, filepath.Join(t.TempDir(), "status.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return context.WithValue(newTestContext(t), ctxKeyReadiness{}, tracker)
+}
+
+// Fails the test if the persisted server state does not match the expected state
+func assertTestServerState(t *testing.T, ctx context.Context, expected ServerState) {
+	t.Helper()
+	state, err := GetServerState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != expected {
+		t.Fatalf("state %s (expected %s)", state, expected)
+	}
+}
+
+func TestReadinessStateMachine(t *testing.T) {
+	ctx := newTestReadinessContext(t, ReadyOnOutput("^Loading done"), ReadyOnOutput("listening on \\d+"))
+	tracker := ReadinessTracker(ctx)
+
+	// a missing status file reports a stopped server
+	assertTestServerState(t, ctx, ServerStateStopped)
+
+	// output is ignored until the server is started
+	tracker.observe(ctx, "Loading done")
+	tracker.start(ctx)
+	assertTestServerState(t, ctx, ServerStateStarting)
+
+	tracker.observe(ctx, "Loading world")
+	tracker.observe(ctx, "Loading done")
+	assertTestServerState(t, ctx, ServerStateStarting)
+	if err := checkServerReady(ctx); err == nil {
+		t.Fatal("expected starting server to be unhealthy")
+	}
+
+	tracker.observe(ctx, "listening on 27015")
+	assertTestServerState(t, ctx, ServerStateReady)
+	if err := checkServerReady(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	SetServerState(ctx, ServerStateStopping)
+	assertTestServerState(t, ctx, ServerStateStopping)
+	SetServerState(ctx, ServerStateStopped)
+	assertTestServerState(t, ctx, ServerStateStopped)
+
+	// restarting the server resets every check
+	tracker.start(ctx)
+	assertTestServerState(t, ctx, ServerStateStarting)
+	tracker.observe(ctx, "listening on 27015")
+	assertTestServerState(t, ctx, ServerStateStarting)
+	tracker.observe(ctx, "Loading done")
+	assertTestServerState(t, ctx, ServerStateReady)
+}
+
+func TestReadinessWithoutChecks(t *testing.T) {
+	ctx := newTestReadinessContext(t)
+	ReadinessTracker(ctx).start(ctx)
+	assertTestServerState(t, ctx, ServerStateReady)
+}
+
+func TestReadinessInvalidPattern(t *testing.T) {
+	_, err := newReadiness([]ReadinessCheck{ReadyOnOutput("(")}, filepath.Join(t.TempDir(), "status.json"))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestReadinessStatusFile(t *testing.T) {
+	ctx := newTestReadinessContext(t)
+	tracker := ReadinessTracker(ctx)
+
+	// a stale status file left behind by a previous run is overwritten on reset
+	err := writeServerStatus(tracker.statusFile, readinessStatus{State: ServerStateReady, Updated: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTestServerState(t, ctx, ServerStateReady)
+	tracker.reset(ctx)
+	assertTestServerState(t, ctx, ServerStateStopped)
+
+	// the status file is replaced atomically - no temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(tracker.statusFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("status directory holds %d entries", len(entries))
+	}
+
+	err = os.WriteFile(tracker.statusFile, []byte("{"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = GetServerState(ctx)
+	if err == nil {
+		t.Fatal("expected error reading corrupt status file")
+	}
+}
+
+func TestReadyOnFile(t *testing.T) {
+	ctx := newTestContext(t)
+	path := filepath.Join(t.TempDir(), "ready")
+	check := ReadyOnFile(path)
+	met, err := check.check(ctx)
+	if err != nil || met {
+		t.Fatalf("met %t (error %v) before file exists", met, err)
+	}
+	err = os.WriteFile(path, []byte{}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	met, err = check.check(ctx)
+	if err != nil || !met {
+		t.Fatalf("met %t (error %v) once file exists", met, err)
+	}
+}
+
+func TestReadyOnTcpPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	check := ReadyOnTcpPort(address)
+
+	met, err := check.check(newTestContext(t))
+	if err != nil || !met {
+		t.Fatalf("met %t (error %v) while listening", met, err)
+	}
+
+	listener.Close()
+	met, err = check.check(newTestContext(t))
+	if err != nil || met {
+		t.Fatalf("met %t (error %v) once closed", met, err)
+	}
+
+	// dials are abandoned once the context is cancelled
+	ctx, cancel := context.WithCancel(newTestContext(t))
+	cancel()
+	met, _ = ReadyOnTcpPort("192.0.2.1:27015").check(ctx)
+	if met {
+		t.Fatal("met with cancelled context")
+	}
+}
+
+func TestReadyOnRcon(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	output := bytes.Buffer{}
+	ctx := context.WithValue(newTestContext(t), ctxKeyLogger{}, slog.New(slog.NewTextHandler(&output, nil)))
+	ctx = context.WithValue(ctx, ctxKeyRconConfig{}, RconOpts{Address: address, Password: "secret", Timeout: time.Second})
+	check := ReadyOnRcon()
+
+	// repeated failures are only logged once
+	for range 3 {
+		met, err := check.check(ctx)
+		if err != nil || met {
+			t.Fatalf("met %t (error %v) without server", met, err)
+		}
+	}
+	if count := strings.Count(output.String(), "rcon not ready"); count != 1 {
+		t.Fatalf("logged %d failures: %q", count, output.String())
+	}
+	if strings.Contains(output.String(), "rcon connect") {
+		t.Fatalf("logged connection attempts: %q", output.String())
+	}
+
+	server := startFakeRconServer(t, "secret", nil)
+	ctx = context.WithValue(ctx, ctxKeyRconConfig{}, RconOpts{Address: server.listener.Addr().String(), Password: "secret", Timeout: time.Second})
+	met, err := check.check(ctx)
+	if err != nil || !met {
+		t.Fatalf("met %t (error %v) with server", met, err)
+	}
+}
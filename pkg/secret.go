@@ -0,0 +1,187 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// secretRedacted replaces secret values within log output
+const secretRedacted = "[REDACTED]"
+
+// secretMinLength is the minimum length of a secret value - shorter values (e.g., '1') would redact unrelated log output and are ignored (with a warning)
+const secretMinLength = 4
+
+// secretsDirDefault is the default directory holding mounted secrets (i.e., the docker secrets mount point)
+const secretsDirDefault = "/run/secrets"
+
+// secrets holds the secret values that are redacted from log output
+type secrets struct {
+	lock   sync.RWMutex
+	logger *slog.Logger
+	values []string
+}
+
+// Creates a new (empty) secrets store
+func newSecrets() *secrets {
+	return &secrets{values: []string{}}
+}
+
+// Adds values to the secrets store (ignoring empty values).  Values are kept longest first so that secrets containing other secrets are redacted whole.
+// Values shorter than [secretMinLength] are not redacted - a warning is logged (if the store has a logger) as they will appear in log output.
+func (s *secrets) add(values ...string) {
+	short := 0
+	s.lock.Lock()
+	for _, value := range values {
+		if value == "" || slices.Contains(s.values, value) {
+			continue
+		}
+		if len(value) < secretMinLength {
+			short += 1
+			continue
+		}
+		s.values = append(s.values, value)
+	}
+	slices.SortFunc(s.values, func(a string, b string) int { return len(b) - len(a) })
+	s.lock.Unlock()
+
+	// logging redacts secrets (acquiring the lock) - warnings are logged once the lock is released
+	if short > 0 && s.logger != nil {
+		s.logger.Warn("secrets too short to redact - they may appear in log output", "count", short, "minLength", secretMinLength)
+	}
+}
+
+// Replaces every secret value within data with [secretRedacted]
+func (s *secrets) redact(data string) string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for _, value := range s.values {
+		data = strings.ReplaceAll(data, value, secretRedacted)
+	}
+	return data
+}
+
+// Redacts secret values from a log attribute - covering strings, errors, [fmt.Stringer] values and string slices (e.g., command arguments).
+// Other values (e.g., structs and maps) are not inspected - secrets must not be logged within them.
+// Intended for use as a [slog.HandlerOptions] ReplaceAttr callback.
+func (s *secrets) replaceAttr(groups []string, attr slog.Attr) slog.Attr {
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		attr.Value = slog.StringValue(s.redact(attr.Value.String()))
+	case slog.KindAny:
+		switch value := attr.Value.Any().(type) {
+		case []string:
+			redacted := make([]string, len(value))
+			for index, item := range value {
+				redacted[index] = s.redact(item)
+			}
+			attr.Value = slog.AnyValue(redacted)
+		case error:
+			attr.Value = slog.StringValue(s.redact(value.Error()))
+		case fmt.Stringer:
+			attr.Value = slog.StringValue(s.redact(value.String()))
+		}
+	}
+	return attr
+}
+
+// Registers values as secrets - redacting them from all subsequent log output (see: [Logger]).
+// Values shorter than [secretMinLength] are not redacted (a warning is logged).
+// Secrets parsed from the environment (see: [ParseEnv]) are registered automatically.
+func RegisterSecret(ctx context.Context, values ...string) {
+	Secrets(ctx).add(values...)
+}
+
+// Returns true if a struct field is marked as holding a secret (i.e., `secret:"true"`)
+func isSecretField(field reflect.StructField) bool {
+	return field.Tag.Get("secret") == "true"
+}
+
+// Reads a secret file - removing a single trailing newline (as is typical of mounted secrets)
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSuffix(string(data), "\n")
+	return strings.TrimSuffix(value, "\r"), nil
+}
+
+// Builds the environment used to parse a config struct - resolving unset variables from files.
+// An unset variable (e.g., 'RCON_PASSWORD') is read from the file named by its '_FILE' variable (e.g., 'RCON_PASSWORD_FILE').
+// Unset variables of secret fields (see: [isSecretField]) are additionally read from a file named after the variable (or its lower-cased name) within secretsDir.
+// Returns the environment and the values of secret fields read from files.
+// Returns an error if a '_FILE' variable references an unreadable file.
+func getSecretEnvironment(cfg any, secretsDir string) (map[string]string, []string, error) {
+	environment := getEnvironment()
+	value := reflect.ValueOf(cfg)
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return environment, nil, nil
+	}
+
+	loaded := []string{}
+	for _, field := range getValidationFields(value, "", "") {
+		if field.variable == "" || field.variable == "-" {
+			continue
+		}
+		if _, ok := environment[field.variable]; ok {
+			continue
+		}
+		fileVariable := fmt.Sprintf("%s_FILE", field.variable)
+		if path, ok := environment[fileVariable]; ok {
+			data, err := readSecretFile(path)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", fileVariable, err)
+			}
+			environment[field.variable] = data
+			if isSecretField(field.field) {
+				loaded = append(loaded, data)
+			}
+			continue
+		}
+		if secretsDir == "" || !isSecretField(field.field) {
+			continue
+		}
+		for _, name := range []string{field.variable, strings.ToLower(field.variable)} {
+			data, err := readSecretFile(filepath.Join(secretsDir, name))
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", field.variable, err)
+			}
+			environment[field.variable] = data
+			loaded = append(loaded, data)
+			break
+		}
+	}
+	return environment, loaded, nil
+}
+
+// Returns the values of a config struct's secret fields (see: [isSecretField])
+func getSecretValues(cfg any) []string {
+	value := reflect.ValueOf(cfg)
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	values := []string{}
+	for _, field := range getValidationFields(value, "", "") {
+		if isSecretField(field.field) {
+			values = append(values, formatValidationValue(field.value))
+		}
+	}
+	return values
+}
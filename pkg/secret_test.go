@@ -0,0 +1,61 @@
+package helper
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func init() {
+	testContextValues[ctxKeySecrets{}] = func() any { return newSecrets() }
+	testContextValues[ctxKeySecretsDir{}] = func() any { return "" }
+}
+
+func TestGetSecretEnvironment(t *testing.T) {
+	type config struct {
+		Mode     string `env:"TEST_MODE"`
+		Password string `env:"TEST_PASSWORD" secret:"true"`
+		Port     string `env:"TEST_PORT"`
+	}
+	dir := t.TempDir()
+	for name, value := range map[string]string{"TEST_MODE": "coop", "test_password": "hunter22\n", "port": "7777"} {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("TEST_PORT_FILE", filepath.Join(dir, "port"))
+
+	environment, loaded, err := getSecretEnvironment(&config{}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := environment["TEST_MODE"]; ok {
+		t.Fatalf("non-secret field loaded from secrets dir")
+	}
+	if environment["TEST_PASSWORD"] != "hunter22" || environment["TEST_PORT"] != "7777" {
+		t.Fatalf("unexpected environment (password: %q, port: %q)", environment["TEST_PASSWORD"], environment["TEST_PORT"])
+	}
+	// only the values of secret fields are treated as secrets
+	if !slices.Equal(loaded, []string{"hunter22"}) {
+		t.Fatalf("loaded %v", loaded)
+	}
+}
+
+func TestSecretsIgnoreShortValues(t *testing.T) {
+	store := newSecrets()
+	output := bytes.Buffer{}
+	store.logger = slog.New(slog.NewTextHandler(&output, &slog.HandlerOptions{ReplaceAttr: store.replaceAttr}))
+	store.add("1", "abc", "hunter22")
+	redacted := store.redact("port 1 abc hunter22")
+	if redacted != "port 1 abc "+secretRedacted {
+		t.Fatalf("redacted %q", redacted)
+	}
+	if !strings.Contains(output.String(), "secrets too short to redact") || !strings.Contains(output.String(), "count=2") {
+		t.Fatalf("short secrets not reported: %q", output.String())
+	}
+}
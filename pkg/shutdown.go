@@ -0,0 +1,111 @@
+package helper
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// shutdownGracePeriodDefault is the time a command is given to exit once stopped before it is killed (see: [CmdStopOpts]).
+// Container runtimes kill the entrypoint after their own stop timeout (e.g., docker's 'stop_grace_period', default: 10s) - the default fits within docker's default.
+// Images with shutdown steps or longer grace periods must raise the runtime's stop timeout to cover both.
+const shutdownGracePeriodDefault = 8 * time.Second
+
+// ShutdownStep is a single step of the entrypoint's shutdown hook chain (e.g., saving the world or broadcasting a warning to players)
+type ShutdownStep struct {
+	Callback entrypointCb
+	Name     string
+	Timeout  time.Duration
+}
+
+// shutdown holds the state associated with the entrypoint's shutdown hook chain
+type shutdown struct {
+	done        chan bool
+	gracePeriod time.Duration
+	once        sync.Once
+	steps       []ShutdownStep
+}
+
+// Creates a new [shutdown] with the provided steps and grace period
+func newShutdown(steps []ShutdownStep, gracePeriod time.Duration) *shutdown {
+	return &shutdown{done: make(chan bool), gracePeriod: gracePeriod, steps: steps}
+}
+
+// Runs the shutdown hook chain - only once, regardless of how many times this method is called.
+// Concurrent callers block until the hook chain has completed.
+// Failing or timed out steps are logged and do not prevent subsequent steps from running.
+func (s *shutdown) run(ctx context.Context) {
+	s.once.Do(func() {
+		defer close(s.done)
+		for _, step := range s.steps {
+			s.runStep(ctx, step)
+		}
+	})
+	<-s.done
+}
+
+// Returns true if the shutdown hook chain has run (i.e., the entrypoint is shutting down)
+func (s *shutdown) ran() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Runs a single shutdown step, bounded by the step's timeout (if set).
+func (s *shutdown) runStep(ctx context.Context, step ShutdownStep) {
+	Logger(ctx).Info("run shutdown step", "name", step.Name, "timeout", step.Timeout.String())
+	stepCtx, cancel := context.WithCancel(ctx)
+	if step.Timeout > 0 {
+		stepCtx, cancel = context.WithTimeout(ctx, step.Timeout)
+	}
+	defer cancel()
+
+	stepErr := make(chan error, 1)
+	go func() {
+		stepErr <- step.Callback(stepCtx)
+	}()
+
+	select {
+	case err := <-stepErr:
+		if err != nil {
+			Logger(ctx).Warn("shutdown step failed", "name", step.Name, "error", err.Error())
+		}
+	case <-stepCtx.Done():
+		Logger(ctx).Warn("shutdown step timed out", "name", step.Name)
+	}
+}
+
+// Runs the entrypoint's shutdown hook chain (once).
+// Called automatically by commands (see: [Command]) upon receiving a termination signal, prior to stopping the command.
+func RunShutdown(ctx context.Context) {
+	ShutdownConfig(ctx).run(ctx)
+}
+
+// Creates a [ShutdownStep] that sends a console command to the rcon server (see: [RconExec]).
+func ShutdownRconStep(command string, timeout time.Duration) ShutdownStep {
+	return ShutdownStep{
+		Callback: func(ctx context.Context) error {
+			_, err := RconExec(ctx, command)
+			return err
+		},
+		Name:    "rcon " + command,
+		Timeout: timeout,
+	}
+}
+
+// Creates a [ShutdownStep] that waits for the provided duration (e.g., to give players time to react to a warning).
+func ShutdownWaitStep(duration time.Duration) ShutdownStep {
+	return ShutdownStep{
+		Callback: func(ctx context.Context) error {
+			select {
+			case <-time.After(duration):
+			case <-ctx.Done():
+			}
+			return nil
+		},
+		Name: "wait " + duration.String(),
+	}
+}
@@ -0,0 +1,152 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Creates a context holding a shutdown hook chain composed of the provided steps
+func newTestShutdownContext(t *testing.T, gracePeriod time.Duration, steps ...ShutdownStep) context.Context {
+	t.Helper()
+	return context.WithValue(newTestContext(t), ctxKeyShutdown{}, newShutdown(steps, gracePeriod))
+}
+
+// Creates a shutdown step that records its name once run
+func recordTestShutdownStep(lock *sync.Mutex, ran *[]string, name string, err error) ShutdownStep {
+	return ShutdownStep{
+		Callback: func(ctx context.Context) error {
+			lock.Lock()
+			defer lock.Unlock()
+			*ran = append(*ran, name)
+			return err
+		},
+		Name: name,
+	}
+}
+
+func TestShutdownSteps(t *testing.T) {
+	lock := sync.Mutex{}
+	ran := []string{}
+	hang := ShutdownStep{
+		Callback: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		Name:    "hang",
+		Timeout: 50 * time.Millisecond,
+	}
+	ctx := newTestShutdownContext(t, time.Second,
+		recordTestShutdownStep(&lock, &ran, "first", nil),
+		recordTestShutdownStep(&lock, &ran, "failing", fmt.Errorf("failed")),
+		hang,
+		recordTestShutdownStep(&lock, &ran, "last", nil),
+	)
+	if ShutdownConfig(ctx).ran() {
+		t.Fatal("ran before shutdown")
+	}
+
+	// concurrent callers share a single run of the hook chain
+	group := sync.WaitGroup{}
+	for range 3 {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			RunShutdown(ctx)
+			if !ShutdownConfig(ctx).ran() {
+				t.Error("returned before hook chain completed")
+			}
+		}()
+	}
+	group.Wait()
+	RunShutdown(ctx)
+
+	// failing and timed out steps don't prevent subsequent steps from running
+	if !slices.Equal(ran, []string{"first", "failing", "last"}) {
+		t.Fatalf("ran %v", ran)
+	}
+}
+
+func TestShutdownWaitStep(t *testing.T) {
+	step := ShutdownWaitStep(time.Hour)
+	ctx, cancel := context.WithTimeout(newTestContext(t), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := step.Callback(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("wait step ignored context cancellation")
+	}
+}
+
+func TestCommandShutdown(t *testing.T) {
+	tests := []struct {
+		name         string
+		script       string
+		stop         CmdStopOpts
+		expectErr    bool
+		expectOutput string
+	}{
+		{name: "stdin command", script: "echo started; read line; echo \"got $line\"", stop: CmdStopOpts{Stdin: "quit"}, expectOutput: "got quit"},
+		{name: "signal forwarded", script: "trap 'echo term; exit 0' TERM; echo started; while true; do sleep 0.05; done", expectOutput: "term"},
+		{name: "killed after grace period", script: "trap '' TERM; echo started; while true; do sleep 0.05; done", stop: CmdStopOpts{GracePeriod: 100 * time.Millisecond}, expectErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lock := sync.Mutex{}
+			ran := []string{}
+			ctx := newTestShutdownContext(t, 10*time.Second, recordTestShutdownStep(&lock, &ran, "save", nil))
+
+			started := make(chan bool, 1)
+			opts := CmdOpts{
+				IgnoreSignals: true,
+				OnStdoutLine: func(line string) {
+					if line == "started" {
+						started <- true
+					}
+				},
+				Stop: test.stop,
+			}
+			cmd := Command(ctx, []string{"sh", "-c", test.script}, opts)
+			type result struct {
+				err    error
+				output string
+			}
+			finished := make(chan result, 1)
+			go func() {
+				output, err := cmd.Run()
+				finished <- result{err: err, output: output}
+			}()
+
+			select {
+			case <-started:
+			case <-time.After(10 * time.Second):
+				t.Fatal("command did not start")
+			}
+			cmd.shutdown(syscall.SIGTERM)
+			if !slices.Equal(ran, []string{"save"}) {
+				t.Fatalf("shutdown steps ran %v", ran)
+			}
+
+			var actual result
+			select {
+			case actual = <-finished:
+			case <-time.After(10 * time.Second):
+				t.Fatal("command did not stop")
+			}
+			if test.expectErr != (actual.err != nil) {
+				t.Fatalf("error %v (expected error: %t)", actual.err, test.expectErr)
+			}
+			if !strings.Contains(actual.output, test.expectOutput) {
+				t.Fatalf("output %q (expected %q)", actual.output, test.expectOutput)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 )
 
@@ -14,18 +15,32 @@ type signalHandlerCb func(sig os.Signal)
 type signalHandlerUnregister func()
 
 // Allows callers to attach signal handlers to common termination signals to perform cleanup.  Returns an function that unregisters the callback.
+// The handler is also unregistered once the provided context is done.
 func HandleSignal(ctx context.Context, cb signalHandlerCb) signalHandlerUnregister {
 	var caught os.Signal
 	channel := make(chan os.Signal, 1)
+	done := make(chan bool)
+	once := sync.Once{}
 
 	signal.Notify(channel, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
-		caught = <-channel
+		// the registration must be released however the handler finishes (including when the context is done)
+		defer signal.Stop(channel)
+		select {
+		case caught = <-channel:
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		}
 		Logger(ctx).Info("signal caught", "signal", caught.String())
 		cb(caught)
 	}()
 
 	return func() {
-		signal.Stop(channel)
+		once.Do(func() {
+			signal.Stop(channel)
+			close(done)
+		})
 	}
 }
@@ -0,0 +1,289 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SteamCmdOpts defines the options used in conjunction with the [SteamCmdAppUpdate] and [SteamCmdWorkshopDownload] functions.
+// Username defaults to 'anonymous' - steam guard protected accounts are unsupported.  Password and BetaPassword are redacted from log output (see: [RegisterSecret]).
+// Transient failures (e.g., timeouts, rate limits, lost connections) are retried Retries times (default: 3 - a negative value disables retries) with an exponential backoff.
+// When Cache is set, installations are stored within (and restored from) the file cache (see: [CacheFile]) - apps are revalidated against their current build id once CacheTTL expires.
+type SteamCmdOpts struct {
+	Beta         string
+	BetaPassword string
+	Cache        bool
+	CacheTTL     time.Duration
+	Executable   string
+	Password     string
+	Platform     string
+	Retries      int
+	RetryBackoff time.Duration
+	Username     string
+	Validate     bool
+}
+
+// Sets defaults for unset fields
+func (opts *SteamCmdOpts) initialize() {
+	if opts.Executable == "" {
+		opts.Executable = "steamcmd"
+	}
+	if opts.Retries == 0 {
+		opts.Retries = 3
+	}
+	if opts.RetryBackoff == 0 {
+		opts.RetryBackoff = 5 * time.Second
+	}
+	if opts.Username == "" {
+		opts.Username = "anonymous"
+	}
+}
+
+// Returns the login arguments for a steamcmd invocation
+func (opts SteamCmdOpts) login() []string {
+	args := []string{}
+	if opts.Platform != "" {
+		args = append(args, "+@sSteamCmdForcePlatformType", opts.Platform)
+	}
+	args = append(args, "+login", opts.Username)
+	if opts.Password != "" {
+		args = append(args, opts.Password)
+	}
+	return args
+}
+
+// Returns the full command for a steamcmd invocation running the provided arguments (followed by '+quit')
+func (opts SteamCmdOpts) command(args ...string) []string {
+	cmdSlice := []string{opts.Executable, "+@ShutdownOnFailedCommand", "1", "+@NoPromptForPassword", "1"}
+	cmdSlice = append(cmdSlice, args...)
+	return append(cmdSlice, "+quit")
+}
+
+// steamCmdError is an error reported by steamcmd that signals whether the invocation can be retried
+type steamCmdError struct {
+	err       error
+	retryable bool
+}
+
+// Returns the underlying error message
+func (se steamCmdError) Error() string {
+	return se.err.Error()
+}
+
+// Returns the underlying error
+func (se steamCmdError) Unwrap() error {
+	return se.err
+}
+
+var (
+	// steamCmdErrorRegex matches lines reporting a steamcmd failure (e.g., "ERROR! Failed to install app '380870' (No subscription)")
+	steamCmdErrorRegex = regexp.MustCompile(`^(ERROR!|Error!|FAILED|Login Failure)`)
+	// steamCmdProgressRegex matches lines reporting download progress (e.g., "Update state (0x61) downloading, progress: 45.12 (123 / 456)")
+	steamCmdProgressRegex = regexp.MustCompile(`Update state \(0x[0-9a-fA-F]+\) ([^,]+), progress: ([\d.]+) \((\d+) / (\d+)\)`)
+	// steamCmdSuccessRegex matches lines reporting a successful install or workshop download
+	steamCmdSuccessRegex = regexp.MustCompile(`^Success(!|\.) (App '\d+' (fully installed|already up to date)|Downloaded item \d+)`)
+	// steamCmdTransientErrors are (lower-cased) substrings of steamcmd errors that are known to be transient - app states are matched by their full error message (e.g., "Error! App '380870' state is 0x602 after update job.")
+	steamCmdTransientErrors = []string{"(failure)", "no connection", "rate limit", "service unavailable", "state is 0x402 after update job", "state is 0x602 after update job", "state is 0x6 after update job", "timeout", "try another cm"}
+)
+
+// steamCmdOutput accumulates the outcome of a steamcmd invocation from its output
+type steamCmdOutput struct {
+	ctx          context.Context
+	errors       []string
+	lastProgress time.Time
+	lastState    string
+	success      bool
+}
+
+// Observes a single line of steamcmd output - logging progress and recording successes and errors
+func (so *steamCmdOutput) observe(line string) {
+	line = strings.TrimSpace(line)
+	if steamCmdSuccessRegex.MatchString(line) {
+		Logger(so.ctx).Info("steamcmd succeeded", "message", line)
+		so.success = true
+		return
+	}
+	if steamCmdErrorRegex.MatchString(line) {
+		Logger(so.ctx).Warn("steamcmd error", "message", line)
+		so.errors = append(so.errors, line)
+		return
+	}
+	match := steamCmdProgressRegex.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	state := strings.TrimSpace(match[1])
+	if state == so.lastState && time.Since(so.lastProgress) < 10*time.Second {
+		return
+	}
+	so.lastState = state
+	so.lastProgress = time.Now()
+	Logger(so.ctx).Info("steamcmd progress", "state", state, "percent", match[2], "bytes", match[3], "total", match[4])
+}
+
+// Returns the outcome of the invocation (given the command's error).
+// Returns a [steamCmdError] if steamcmd reported an error, exited with an error or did not report success.
+func (so *steamCmdOutput) result(cmdErr error) error {
+	if len(so.errors) > 0 {
+		message := strings.Join(so.errors, "; ")
+		retryable := false
+		for _, transient := range steamCmdTransientErrors {
+			if strings.Contains(strings.ToLower(message), transient) {
+				retryable = true
+				break
+			}
+		}
+		return steamCmdError{err: fmt.Errorf("steamcmd failed: %s", message), retryable: retryable}
+	}
+	// steamcmd occasionally exits abnormally (e.g., after updating itself) without reporting an error
+	if cmdErr != nil {
+		return steamCmdError{err: fmt.Errorf("steamcmd failed: %w", cmdErr), retryable: true}
+	}
+	if !so.success {
+		return steamCmdError{err: fmt.Errorf("steamcmd did not report success"), retryable: true}
+	}
+	return nil
+}
+
+// Runs steamcmd with the provided arguments, retrying transient failures with an exponential backoff.
+// Returns an error if steamcmd fails.
+func runSteamCmd(ctx context.Context, args []string, opts SteamCmdOpts) error {
+	cmdSlice := opts.command(args...)
+	backoff := opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		output := steamCmdOutput{ctx: ctx}
+		_, cmdErr := Command(ctx, cmdSlice, CmdOpts{OnStdoutLine: output.observe}).Run()
+		err := output.result(cmdErr)
+		if err == nil {
+			return nil
+		}
+
+		scErr := steamCmdError{}
+		retryable := errors.As(err, &scErr) && scErr.retryable
+		if !retryable || attempt >= opts.Retries || ctx.Err() != nil {
+			return err
+		}
+		Logger(ctx).Warn("steamcmd failed - retrying", "error", err.Error(), "attempt", attempt+1, "backoff", backoff.String())
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// Parses the build id of an app's branch from 'app_info_print' output.
+// Returns an error if the branch (or its build id) cannot be found.
+func parseSteamCmdBuildId(output string, branch string) (string, error) {
+	inBranches := false
+	inBranch := false
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(strings.ReplaceAll(line, `"`, " "))
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case len(fields) == 1 && fields[0] == "branches":
+			inBranches = true
+		case inBranches && len(fields) == 1 && fields[0] == branch:
+			inBranch = true
+		case inBranch && len(fields) == 2 && fields[0] == "buildid":
+			return fields[1], nil
+		}
+	}
+	return "", fmt.Errorf("build id for branch %s not found", branch)
+}
+
+// Returns a callback that revalidates a cached app installation by querying the current build id of the app's branch
+func getSteamCmdBuildIdValidator(ctx context.Context, appId int, opts SteamCmdOpts) fileCacheValidateCb {
+	return func(validator string) (string, error) {
+		branch := opts.Beta
+		if branch == "" {
+			branch = "public"
+		}
+		args := append(opts.login(), "+app_info_update", "1", "+app_info_print", strconv.Itoa(appId))
+		output, err := Command(ctx, opts.command(args...), CmdOpts{}).Run()
+		if err != nil {
+			return "", err
+		}
+		return parseSteamCmdBuildId(output, branch)
+	}
+}
+
+// Installs (or updates) a steam app into dir via steamcmd (i.e., '+force_install_dir <dir> +login <user> +app_update <id> [-beta <beta>] [validate] +quit').
+// When caching, the installation is stored within the file cache (keyed by app id and branch) and restored into dir.
+// Returns an error if steamcmd fails (after retrying transient failures).
+// Returns an error if any file cache operation fails.
+func SteamCmdAppUpdate(ctx context.Context, appId int, dir string, opts SteamCmdOpts) error {
+	opts.initialize()
+	RegisterSecret(ctx, opts.Password, opts.BetaPassword)
+	install := func(path string) error {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		Logger(ctx).Info("steamcmd app update", "app", appId, "beta", opts.Beta, "dir", path)
+		args := append([]string{"+force_install_dir", path}, opts.login()...)
+		args = append(args, "+app_update", strconv.Itoa(appId))
+		if opts.Beta != "" {
+			args = append(args, "-beta", opts.Beta)
+		}
+		if opts.BetaPassword != "" {
+			args = append(args, "-betapassword", opts.BetaPassword)
+		}
+		if opts.Validate {
+			args = append(args, "validate")
+		}
+		return runSteamCmd(ctx, args, opts)
+	}
+	if !opts.Cache {
+		return install(dir)
+	}
+	branch := opts.Beta
+	if branch == "" {
+		branch = "public"
+	}
+	key := fmt.Sprintf("steamcmd-app-%d-%s", appId, branch)
+	return CacheFile(ctx, key, dir, install, CacheFileOpts{TTL: opts.CacheTTL, Validate: getSteamCmdBuildIdValidator(ctx, appId, opts)})
+}
+
+// Downloads a workshop item into dir via steamcmd (i.e., '+force_install_dir <dir> +login <user> +workshop_download_item <app id> <item id> [validate] +quit').
+// When caching, the download is stored within the file cache (keyed by app id and item id) and restored into dir.
+// Returns the path containing the workshop item's contents.
+// Returns an error if steamcmd fails (after retrying transient failures).
+// Returns an error if any file cache operation fails.
+func SteamCmdWorkshopDownload(ctx context.Context, appId int, itemId int, dir string, opts SteamCmdOpts) (string, error) {
+	opts.initialize()
+	RegisterSecret(ctx, opts.Password)
+	download := func(path string) error {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		Logger(ctx).Info("steamcmd workshop download", "app", appId, "item", itemId, "dir", path)
+		args := append([]string{"+force_install_dir", path}, opts.login()...)
+		args = append(args, "+workshop_download_item", strconv.Itoa(appId), strconv.Itoa(itemId))
+		if opts.Validate {
+			args = append(args, "validate")
+		}
+		return runSteamCmd(ctx, args, opts)
+	}
+	var err error
+	if opts.Cache {
+		key := fmt.Sprintf("steamcmd-workshop-%d-%d", appId, itemId)
+		err = CacheFile(ctx, key, dir, download, CacheFileOpts{TTL: opts.CacheTTL})
+	} else {
+		err = download(dir)
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "steamapps", "workshop", "content", strconv.Itoa(appId), strconv.Itoa(itemId)), nil
+}
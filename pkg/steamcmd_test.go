@@ -0,0 +1,82 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Writes a fake steamcmd executable that prints the given output lines (one per invocation) and returns its path.
+// Invocations are counted within '<executable>.count'.
+func writeFakeSteamCmd(t *testing.T, outputs ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	executable := filepath.Join(dir, "steamcmd")
+	err := os.WriteFile(executable+".output", []byte(strings.Join(outputs, "\n")+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := `#!/bin/sh
+count=$(cat "$0.count" 2>/dev/null || echo 0)
+count=$((count + 1))
+echo "$count" > "$0.count"
+sed -n "${count}p" "$0.output"
+`
+	err = os.WriteFile(executable, []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return executable
+}
+
+// Returns the number of times a fake steamcmd executable was invoked
+func getFakeSteamCmdCount(t *testing.T, executable string) int {
+	t.Helper()
+	data, err := os.ReadFile(executable + ".count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	_, err = fmt.Sscan(string(data), &count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestSteamCmdAppUpdate(t *testing.T) {
+	tests := []struct {
+		name        string
+		outputs     []string
+		expectErr   bool
+		invocations int
+	}{
+		{name: "success", outputs: []string{"Success! App '740' fully installed."}, invocations: 1},
+		{name: "retries transient state", outputs: []string{"Error! App '740' state is 0x602 after update job.", "Success! App '740' fully installed."}, invocations: 2},
+		{name: "fails permanent error", outputs: []string{"ERROR! Failed to install app '740' (No subscription)", "Success! App '740' fully installed."}, expectErr: true, invocations: 1},
+		{name: "ignores state-like substrings", outputs: []string{"ERROR! Failed to install app '740' (Invalid platform 0x6 )", "Success! App '740' fully installed."}, expectErr: true, invocations: 1},
+		{name: "retries silent exit", outputs: []string{"Loading Steam API...OK", "Success! App '740' already up to date."}, invocations: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(t)
+			executable := writeFakeSteamCmd(t, test.outputs...)
+			opts := SteamCmdOpts{Executable: executable, RetryBackoff: time.Millisecond}
+
+			err := SteamCmdAppUpdate(ctx, 740, t.TempDir(), opts)
+			if test.expectErr && err == nil {
+				t.Fatal("expected steamcmd to fail")
+			}
+			if !test.expectErr && err != nil {
+				t.Fatal(err)
+			}
+			count := getFakeSteamCmdCount(t, executable)
+			if count != test.invocations {
+				t.Fatalf("steamcmd invoked %d times (expected %d)", count, test.invocations)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// RestartPolicy determines whether a supervised command is restarted after it exits
+type RestartPolicy string
+
+const (
+	// RestartPolicyAlways restarts the command regardless of how it exited
+	RestartPolicyAlways RestartPolicy = "always"
+	// RestartPolicyNever never restarts the command
+	RestartPolicyNever RestartPolicy = "never"
+	// RestartPolicyOnFailure restarts the command only when it exits with an error
+	RestartPolicyOnFailure RestartPolicy = "on-failure"
+)
+
+// SuperviseOpts defines the options used in conjunction with the [Supervise] function.
+// MaxRestarts defaults to 5 when nil - a value of 0 fails on the first restart.
+type SuperviseOpts struct {
+	Backoff       time.Duration `env:"SUPERVISE_BACKOFF"`
+	BackoffLimit  time.Duration `env:"SUPERVISE_BACKOFF_LIMIT"`
+	BackoffReset  time.Duration `env:"SUPERVISE_BACKOFF_RESET"`
+	MaxRestarts   *int          `env:"SUPERVISE_MAX_RESTARTS"`
+	Policy        RestartPolicy `env:"SUPERVISE_POLICY"`
+	RestartWindow time.Duration `env:"SUPERVISE_RESTART_WINDOW"`
+}
+
+// Sets defaults for unset fields and validates the provided options.
+// Returns an error if the restart policy is unrecognized.
+func (opts *SuperviseOpts) initialize() error {
+	if opts.Backoff == 0 {
+		opts.Backoff = 1 * time.Second
+	}
+	if opts.BackoffLimit == 0 {
+		opts.BackoffLimit = 5 * time.Minute
+	}
+	if opts.BackoffReset == 0 {
+		opts.BackoffReset = 10 * time.Minute
+	}
+	if opts.MaxRestarts == nil {
+		maxRestarts := 5
+		opts.MaxRestarts = &maxRestarts
+	}
+	if opts.Policy == "" {
+		opts.Policy = RestartPolicyOnFailure
+	}
+	if opts.RestartWindow == 0 {
+		opts.RestartWindow = 10 * time.Minute
+	}
+	switch opts.Policy {
+	case RestartPolicyAlways, RestartPolicyNever, RestartPolicyOnFailure:
+	default:
+		return fmt.Errorf("unrecognized restart policy %s", opts.Policy)
+	}
+	return nil
+}
+
+// Adds to the counter of supervised game server restarts
+func addServerRestarts(ctx context.Context, value float64) {
+	AddCounter(ctx, "gsh_server_restarts_total", "Number of times the supervised game server process has been restarted", value, nil)
+}
+
+// Runs a command (see: [Command]) under a supervisor, restarting the command according to the configured [RestartPolicy].
+// Restarts are delayed by an exponential backoff (starting at Backoff and capped at BackoffLimit) that resets once the command has stayed up for BackoffReset.
+// The supervised command is treated as the game server - its lifecycle and output drive the entrypoint's readiness checks (see: [CmdOpts]).
+// Environment variables (e.g., SUPERVISE_POLICY) override the provided options, allowing operators to tune the supervisor without rebuilding images.
+// Returns nil once the command exits successfully (unless the policy is 'always') or once a termination signal is received.
+// Returns an error if the command fails and the policy is 'never'.
+// Returns an error if the command is restarted more than MaxRestarts times within RestartWindow (i.e., it is crash looping).
+func Supervise(ctx context.Context, cmdSlice []string, cmdOpts CmdOpts, opts SuperviseOpts) error {
+	err := ParseEnv(ctx, &opts)
+	if err != nil {
+		return err
+	}
+	err = opts.initialize()
+	if err != nil {
+		return err
+	}
+	// registers the restart counter (at zero) so that it is exported before the first restart
+	addServerRestarts(ctx, 0)
+
+	stopping := atomic.Bool{}
+	stopped := make(chan bool, 1)
+	unregister := HandleSignal(ctx, func(sig os.Signal) {
+		stopping.Store(true)
+		stopped <- true
+	})
+	defer unregister()
+
+	cmdOpts.TrackReadiness = true
+	backoff := opts.Backoff
+	restarts := []time.Time{}
+	for {
+		start := time.Now()
+		_, err := Command(ctx, cmdSlice, cmdOpts).Run()
+		uptime := time.Since(start)
+
+		if stopping.Load() {
+			Logger(ctx).Info("supervised command stopped", "command", cmdSlice)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil && opts.Policy != RestartPolicyAlways {
+			return nil
+		}
+		if err != nil && opts.Policy == RestartPolicyNever {
+			return err
+		}
+
+		now := time.Now()
+		recent := []time.Time{}
+		for _, restart := range restarts {
+			if now.Sub(restart) < opts.RestartWindow {
+				recent = append(recent, restart)
+			}
+		}
+		restarts = append(recent, now)
+		if len(restarts) > *opts.MaxRestarts {
+			crashErr := fmt.Errorf("command crash looping - %d restarts within %s", len(restarts), opts.RestartWindow)
+			if err != nil {
+				crashErr = fmt.Errorf("%w: %w", crashErr, err)
+			}
+			return crashErr
+		}
+
+		if uptime >= opts.BackoffReset {
+			backoff = opts.Backoff
+		}
+		errMsg := ""
+		if err != nil {
+			errMsg = err.Error()
+		}
+		addServerRestarts(ctx, 1)
+		Logger(ctx).Warn("restart supervised command", "command", cmdSlice, "error", errMsg, "uptime", uptime.String(), "backoff", backoff.String(), "restarts", len(restarts))
+
+		select {
+		case <-time.After(backoff):
+		case <-stopped:
+			Logger(ctx).Info("supervised command stopped", "command", cmdSlice)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		backoff = min(backoff*2, opts.BackoffLimit)
+	}
+}
@@ -0,0 +1,135 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns a command that fails for its first n runs (and succeeds afterwards) - counting its runs within the given file
+func failingTestCommand(file string, failures int) []string {
+	script := `runs=$(cat "$1" 2>/dev/null || echo 0); runs=$((runs + 1)); echo "$runs" > "$1"; [ "$runs" -gt "$2" ]`
+	return []string{"sh", "-c", script, "sh", file, strconv.Itoa(failures)}
+}
+
+// Returns the number of runs recorded by a [failingTestCommand]
+func countTestRuns(t *testing.T, file string) int {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runs
+}
+
+func TestSupervise(t *testing.T) {
+	intPtr := func(value int) *int { return &value }
+	tests := []struct {
+		name         string
+		env          Map[string, string]
+		failures     int
+		opts         SuperviseOpts
+		expectErr    string
+		expectedRuns int
+	}{
+		{name: "on-failure restarts until success", failures: 2, opts: SuperviseOpts{}, expectedRuns: 3},
+		{name: "on-failure exits on success", failures: 0, opts: SuperviseOpts{}, expectedRuns: 1},
+		{name: "never returns failure", failures: 1, opts: SuperviseOpts{Policy: RestartPolicyNever}, expectErr: "exit status 1", expectedRuns: 1},
+		{name: "always restarts after success", failures: 0, opts: SuperviseOpts{MaxRestarts: intPtr(2), Policy: RestartPolicyAlways}, expectErr: "crash looping - 3 restarts", expectedRuns: 3},
+		{name: "crash loop", failures: 100, opts: SuperviseOpts{MaxRestarts: intPtr(3)}, expectErr: "crash looping - 4 restarts", expectedRuns: 4},
+		{name: "zero max restarts", failures: 100, opts: SuperviseOpts{MaxRestarts: intPtr(0)}, expectErr: "crash looping - 1 restarts", expectedRuns: 1},
+		{name: "restarts outside window", failures: 3, opts: SuperviseOpts{MaxRestarts: intPtr(1), RestartWindow: time.Nanosecond}, expectedRuns: 4},
+		{name: "environment overrides options", env: Map[string, string]{"SUPERVISE_POLICY": "never"}, failures: 1, opts: SuperviseOpts{Policy: RestartPolicyAlways}, expectErr: "exit status 1", expectedRuns: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for variable, value := range test.env {
+				t.Setenv(variable, value)
+			}
+			ctx := newTestReadinessContext(t)
+			file := filepath.Join(t.TempDir(), "runs")
+			opts := test.opts
+			opts.Backoff = time.Millisecond
+
+			err := Supervise(ctx, failingTestCommand(file, test.failures), CmdOpts{}, opts)
+			if test.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectErr) {
+					t.Fatalf("error %v (expected %q)", err, test.expectErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			runs := countTestRuns(t, file)
+			if runs != test.expectedRuns {
+				t.Fatalf("ran %d times (expected %d)", runs, test.expectedRuns)
+			}
+
+			// restarts are counted by the restart metric - a restart refused due to crash looping is not counted
+			output := bytes.Buffer{}
+			err = Metrics(ctx).write(&output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			restarts := strconv.Itoa(test.expectedRuns - 1)
+			if !strings.Contains(output.String(), "gsh_server_restarts_total "+restarts+"\n") {
+				t.Fatalf("restart metric does not report %s restarts: %q", restarts, output.String())
+			}
+		})
+	}
+}
+
+func TestSuperviseBackoff(t *testing.T) {
+	ctx := newTestReadinessContext(t)
+	file := filepath.Join(t.TempDir(), "runs")
+	opts := SuperviseOpts{Backoff: 100 * time.Millisecond, BackoffLimit: 150 * time.Millisecond}
+
+	// backoff doubles (capped at the limit) between restarts - 100ms, 150ms, 150ms
+	start := time.Now()
+	err := Supervise(ctx, failingTestCommand(file, 3), CmdOpts{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	if elapsed < 400*time.Millisecond {
+		t.Fatalf("restarted after %s (expected backoff of at least 400ms)", elapsed)
+	}
+	if elapsed > 5*time.Second {
+		t.Fatalf("restarted after %s (backoff limit exceeded)", elapsed)
+	}
+	if runs := countTestRuns(t, file); runs != 4 {
+		t.Fatalf("ran %d times (expected 4)", runs)
+	}
+}
+
+func TestSuperviseCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(newTestReadinessContext(t))
+	file := filepath.Join(t.TempDir(), "runs")
+	opts := SuperviseOpts{Backoff: time.Hour}
+
+	// cancellation interrupts the backoff
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	err := Supervise(ctx, failingTestCommand(file, 100), CmdOpts{}, opts)
+	if err != context.Canceled {
+		t.Fatalf("error %v (expected %v)", err, context.Canceled)
+	}
+}
+
+func TestSuperviseInvalidPolicy(t *testing.T) {
+	ctx := newTestReadinessContext(t)
+	err := Supervise(ctx, []string{"true"}, CmdOpts{}, SuperviseOpts{Policy: "sometimes"})
+	if err == nil || !strings.Contains(err.Error(), "unrecognized restart policy") {
+		t.Fatalf("error %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// RenderTemplatesOpts defines the options used in conjunction with the [RenderTemplate] and [RenderTemplates] functions.
+// Data is passed to templates as the root ('.') value, and Funcs extend (or override) the default template functions (see: [templateFuncs]).
+// If Owner is set, rendered files (and created directories) are owned by the given user (including root - i.e., &User{}).
+// If DryRun is set, rendered output is printed (to Output - default: stdout) rather than written.
+type RenderTemplatesOpts struct {
+	Data   any
+	DryRun bool
+	Funcs  template.FuncMap
+	Output io.Writer
+	Owner  *User
+}
+
+// Returns the default template functions:
+//
+//	env "NAME"                 - the value of an environment variable (empty if unset)
+//	default "fallback" value   - value, or fallback if value is empty
+//	required "message" value   - value, or fails rendering with message if value is empty
+//	bool value                 - value coerced to a boolean ('true', '1', 'yes', 'on', ...)
+//	int value                  - value coerced to an integer
+//	dir "name"                 - the path of an entrypoint directory (see: [Dirs])
+func templateFuncs(ctx context.Context) template.FuncMap {
+	return template.FuncMap{
+		"bool": func(value any) (bool, error) {
+			switch value := value.(type) {
+			case bool:
+				return value, nil
+			case nil:
+				return false, nil
+			}
+			data := strings.ToLower(strings.TrimSpace(fmt.Sprint(value)))
+			switch data {
+			case "", "no", "off":
+				return false, nil
+			case "yes", "on":
+				return true, nil
+			}
+			return strconv.ParseBool(data)
+		},
+		"default": func(fallback any, value any) any {
+			if templateIsEmpty(value) {
+				return fallback
+			}
+			return value
+		},
+		"dir": func(name string) (string, error) {
+			path, ok := Dirs(ctx)[name]
+			if !ok {
+				return "", fmt.Errorf("directory %s unset", name)
+			}
+			return path, nil
+		},
+		"env": func(name string) string {
+			return os.Getenv(name)
+		},
+		"int": func(value any) (int, error) {
+			switch value := value.(type) {
+			case int:
+				return value, nil
+			case nil:
+				return 0, nil
+			}
+			return strconv.Atoi(strings.TrimSpace(fmt.Sprint(value)))
+		},
+		"required": func(message string, value any) (any, error) {
+			if templateIsEmpty(value) {
+				return nil, fmt.Errorf("%s", message)
+			}
+			return value, nil
+		},
+	}
+}
+
+// Returns true if a template value is empty (i.e., nil, or the zero value of its type)
+func templateIsEmpty(value any) bool {
+	if value == nil {
+		return true
+	}
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return reflected.Len() == 0
+	}
+	return reflected.IsZero()
+}
+
+// Renders a single template file (src) to dest - see [RenderTemplatesOpts].
+// Missing map keys are treated as errors.
+// The rendered file is written in place (following symlinks) and takes the template's mode.
+// Returns an error if the template cannot be parsed or executed.
+// Returns an error if the rendered file cannot be written or its ownership cannot be set.
+func RenderTemplate(ctx context.Context, src string, dest string, opts RenderTemplatesOpts) error {
+	Logger(ctx).Info("render template", "src", src, "dest", dest, "dryRun", opts.DryRun)
+	stat, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	funcs := templateFuncs(ctx)
+	for name, function := range opts.Funcs {
+		funcs[name] = function
+	}
+	tmpl, err := template.New(filepath.Base(src)).Funcs(funcs).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return err
+	}
+	rendered := bytes.Buffer{}
+	err = tmpl.Execute(&rendered, opts.Data)
+	if err != nil {
+		return err
+	}
+
+	if opts.DryRun {
+		output := opts.Output
+		if output == nil {
+			output = os.Stdout
+		}
+		_, err = fmt.Fprintf(output, "# %s\n%s\n", dest, rendered.String())
+		return err
+	}
+
+	err = CreateDirs(ctx, filepath.Dir(dest))
+	if err != nil {
+		return err
+	}
+	// dest is written in place - symlinked (or bind-mounted) destinations are preserved
+	err = os.WriteFile(dest, rendered.Bytes(), stat.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(dest, stat.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if opts.Owner != nil {
+		return os.Chown(dest, opts.Owner.Uid, opts.Owner.Gid)
+	}
+	return nil
+}
+
+// Renders a directory of templates (src) into a target directory (dest) - see [RenderTemplatesOpts].
+// Relative paths are preserved, and a '.tmpl' suffix (if present) is removed from rendered file names.
+// Returns an error if any template fails to render.
+func RenderTemplates(ctx context.Context, src string, dest string, opts RenderTemplatesOpts) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relpath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, strings.TrimSuffix(relpath, ".tmpl"))
+		if entry.IsDir() {
+			if opts.DryRun {
+				return nil
+			}
+			err = CreateDirs(ctx, target)
+			if err == nil && opts.Owner != nil {
+				err = os.Chown(target, opts.Owner.Uid, opts.Owner.Gid)
+			}
+			return err
+		}
+		return RenderTemplate(ctx, path, target, opts)
+	})
+}
@@ -0,0 +1,53 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderTemplateSymlinkedDest(t *testing.T) {
+	ctx := newTestContext(t)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "config.tmpl")
+	err := os.WriteFile(src, []byte("name={{ .Name }}"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "target.cfg")
+	err = os.WriteFile(target, []byte(""), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(dir, "dest.cfg")
+	err = os.Symlink(target, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = RenderTemplate(ctx, src, dest, RenderTemplatesOpts{Data: map[string]string{"Name": "server"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lstat, err := os.Lstat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lstat.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("symlink replaced by a regular file")
+	}
+	stat, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode().Perm() != 0640 {
+		t.Fatalf("target mode %s (expected template mode)", stat.Mode().Perm())
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "name=server" {
+		t.Fatalf("target holds %q", data)
+	}
+}
@@ -0,0 +1,23 @@
+package helper
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+// testContextValues holds the context values (by context key) added to every test context - registered by the tests of the features that introduce them (see: [newTestContext])
+var testContextValues = map[any]func() any{}
+
+// Creates a context holding the values helper functions expect (e.g., a logger) - mirroring the entrypoint's context
+func newTestContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, ctxKeyLogger{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx = context.WithValue(ctx, ctxKeyDirs{}, Map[string, string]{})
+	for key, value := range testContextValues {
+		ctx = context.WithValue(ctx, key, value())
+	}
+	return ctx
+}
@@ -0,0 +1,432 @@
+package helper
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+)
+
+// ValidationError describes a config field (and the environment variable that sets it) whose value fails a validation rule (see: [ValidateConfig])
+type ValidationError struct {
+	Field    string
+	Message  string
+	Rule     string
+	Value    string
+	Variable string
+}
+
+// Returns a message naming the invalid variable (or field) and its value
+func (ve ValidationError) Error() string {
+	name := ve.Variable
+	if name == "" {
+		name = ve.Field
+	}
+	if name == "" {
+		return ve.Message
+	}
+	return fmt.Sprintf("%s=%q %s", name, ve.Value, ve.Message)
+}
+
+// ValidationErrors aggregates every [ValidationError] found while validating a config
+type ValidationErrors []ValidationError
+
+// Returns a single-line summary of every validation error
+func (ves ValidationErrors) Error() string {
+	messages := []string{}
+	for _, ve := range ves {
+		messages = append(messages, ve.Error())
+	}
+	return fmt.Sprintf("invalid config: %s", strings.Join(messages, "; "))
+}
+
+// Returns a multi-line report listing every validation error
+func (ves ValidationErrors) report() string {
+	lines := []string{fmt.Sprintf("invalid config (%d errors):", len(ves))}
+	for _, ve := range ves {
+		lines = append(lines, fmt.Sprintf("  %s", ve.Error()))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// validationRule is a single rule parsed from a 'validate' struct tag (e.g., 'min=1')
+type validationRule struct {
+	name  string
+	param string
+}
+
+// Parses the rules of a 'validate' struct tag.  Rules are comma-separated - 'regex' consumes the remainder of the tag (and so may contain commas) and must be the last rule.
+// Returns an error if a rule is unrecognized or is missing its parameter.
+func parseValidationRules(tag string) ([]validationRule, error) {
+	rules := []validationRule{}
+	for tag != "" {
+		item := tag
+		if !strings.HasPrefix(tag, "regex=") {
+			item, tag, _ = strings.Cut(tag, ",")
+		} else {
+			tag = ""
+		}
+		name, param, hasParam := strings.Cut(strings.TrimSpace(item), "=")
+		switch name {
+		case "required":
+			if hasParam {
+				return nil, fmt.Errorf("rule %s does not accept a parameter", name)
+			}
+		case "max", "min", "oneof", "regex", "required_if":
+			if !hasParam || param == "" {
+				return nil, fmt.Errorf("rule %s requires a parameter", name)
+			}
+		default:
+			return nil, fmt.Errorf("unrecognized validation rule %s", name)
+		}
+		rules = append(rules, validationRule{name: name, param: param})
+	}
+	return rules, nil
+}
+
+// validationField is a (possibly nested) struct field subject to validation
+type validationField struct {
+	field    reflect.StructField
+	parent   reflect.Value
+	path     string
+	value    reflect.Value
+	variable string
+}
+
+// Returns the fields of a struct value (recursing into nested structs), naming each field's environment variable (honoring 'envPrefix' tags)
+func getValidationFields(value reflect.Value, path string, prefix string) []validationField {
+	fields := []validationField{}
+	for index := 0; index < value.NumField(); index++ {
+		field := value.Type().Field(index)
+		if !field.IsExported() {
+			continue
+		}
+		fieldValue := value.Field(index)
+		fieldPath := field.Name
+		if path != "" {
+			fieldPath = fmt.Sprintf("%s.%s", path, field.Name)
+		}
+		if fieldValue.Kind() == reflect.Pointer && !fieldValue.IsNil() && fieldValue.Elem().Kind() == reflect.Struct {
+			fieldValue = fieldValue.Elem()
+		}
+		if fieldValue.Kind() == reflect.Struct && fieldValue.Type() != reflect.TypeOf(time.Time{}) {
+			fields = append(fields, getValidationFields(fieldValue, fieldPath, prefix+field.Tag.Get("envPrefix"))...)
+			continue
+		}
+		variable, _, _ := strings.Cut(field.Tag.Get("env"), ",")
+		if variable != "" && variable != "-" {
+			variable = prefix + variable
+		}
+		fields = append(fields, validationField{field: field, parent: value, path: fieldPath, value: fieldValue, variable: variable})
+	}
+	return fields
+}
+
+// Formats a field value as it would appear within an environment variable
+func formatValidationValue(value reflect.Value) string {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return ""
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		items := []string{}
+		for index := 0; index < value.Len(); index++ {
+			items = append(items, formatValidationValue(value.Index(index)))
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value.Interface())
+}
+
+// Compares a field value against a min/max rule parameter - strings, slices and maps compare their length.
+// Returns -1, 0 or 1 if the value is less than, equal to or greater than the parameter.
+// Returns an error if the parameter cannot be parsed for the field's type.
+func compareValidationValue(value reflect.Value, param string) (int, error) {
+	for value.Kind() == reflect.Pointer {
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		limit, err := strconv.Atoi(param)
+		if err != nil {
+			return 0, err
+		}
+		return cmp.Compare(value.Len(), limit), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value.Type() == reflect.TypeOf(time.Duration(0)) {
+			limit, err := time.ParseDuration(param)
+			if err != nil {
+				return 0, err
+			}
+			return cmp.Compare(value.Int(), int64(limit)), nil
+		}
+		limit, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return cmp.Compare(value.Int(), limit), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		limit, err := strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return cmp.Compare(value.Uint(), limit), nil
+	case reflect.Float32, reflect.Float64:
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return 0, err
+		}
+		return cmp.Compare(value.Float(), limit), nil
+	}
+	return 0, fmt.Errorf("unsupported type %s", value.Type())
+}
+
+// Evaluates a single rule against a field.
+// Returns a message describing the failure (or an empty string if the rule passes).
+// Returns an error if the rule's parameter is invalid.
+func (vf validationField) check(rule validationRule) (string, error) {
+	switch rule.name {
+	case "max":
+		result, err := compareValidationValue(vf.value, rule.param)
+		if err != nil {
+			return "", err
+		}
+		if result > 0 {
+			return fmt.Sprintf("must be at most %s", rule.param), nil
+		}
+	case "min":
+		result, err := compareValidationValue(vf.value, rule.param)
+		if err != nil {
+			return "", err
+		}
+		if result < 0 {
+			return fmt.Sprintf("must be at least %s", rule.param), nil
+		}
+	case "oneof":
+		choices := strings.Fields(rule.param)
+		if !slices.Contains(choices, formatValidationValue(vf.value)) {
+			return fmt.Sprintf("must be one of: %s", strings.Join(choices, ", ")), nil
+		}
+	case "regex":
+		pattern, err := regexp.Compile(rule.param)
+		if err != nil {
+			return "", err
+		}
+		if !pattern.MatchString(formatValidationValue(vf.value)) {
+			return fmt.Sprintf("must match %s", rule.param), nil
+		}
+	}
+	return "", nil
+}
+
+// Validates a single field against the rules of its 'validate' struct tag.
+// A field is unset when its environment variable is absent from environment and it holds its zero value - explicitly set zero values (e.g., 'PORT=0') are validated.
+// Rules other than 'required' and 'required_if' are skipped when the field is unset.
+// Returns the validation error for the first failing rule (or nil).
+// Returns an error if the field's rules are invalid.
+func (vf validationField) validate(environment map[string]string) (*ValidationError, error) {
+	rules, err := parseValidationRules(vf.field.Tag.Get("validate"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", vf.path, err)
+	}
+	fail := func(rule validationRule, message string) (*ValidationError, error) {
+		value := formatValidationValue(vf.value)
+		if isSecretField(vf.field) {
+			value = secretRedacted
+		}
+		return &ValidationError{Field: vf.path, Message: message, Rule: rule.name, Value: value, Variable: vf.variable}, nil
+	}
+	_, present := environment[vf.variable]
+	unset := !present && vf.value.IsZero()
+	for _, rule := range rules {
+		switch rule.name {
+		case "required":
+			if unset {
+				return fail(rule, "is required")
+			}
+			continue
+		case "required_if":
+			name, expected, _ := strings.Cut(rule.param, " ")
+			other := vf.parent.FieldByName(name)
+			if !other.IsValid() {
+				return nil, fmt.Errorf("%s: required_if references unknown field %s", vf.path, name)
+			}
+			if unset && formatValidationValue(other) == expected {
+				return fail(rule, fmt.Sprintf("is required when %s is %q", name, expected))
+			}
+			continue
+		}
+		if unset {
+			continue
+		}
+		message, err := vf.check(rule)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", vf.path, rule.name, err)
+		}
+		if message != "" {
+			return fail(rule, message)
+		}
+	}
+	return nil, nil
+}
+
+// Validates a config struct against the rules of its fields' 'validate' struct tags (recursing into nested structs):
+//
+//	required               - the field must be set (i.e., its environment variable is present or it holds a non-zero value)
+//	required_if=Field val  - the field must be set when a sibling field's value is val
+//	min=N, max=N           - numbers (and durations - e.g., 'min=1s') must lie within the bound, strings, slices and maps must have a length within the bound
+//	oneof=a b c            - the field's value must be one of the space-separated choices
+//	regex=pattern          - the field's value must match the pattern (must be the last rule - the pattern may contain commas)
+//
+// Fields are considered set if their environment variable is present within the process' environment.
+// Returns [ValidationErrors] listing every invalid field.
+// Returns an error if cfg is not a struct (or a pointer to one) or if any field's rules are invalid.
+func ValidateConfig(cfg any) error {
+	return validateConfig(cfg, getEnvironment())
+}
+
+// Returns the process' environment as a map
+func getEnvironment() map[string]string {
+	environment := map[string]string{}
+	for _, item := range os.Environ() {
+		key, value, _ := strings.Cut(item, "=")
+		environment[key] = value
+	}
+	return environment
+}
+
+// Validates a config struct (see: [ValidateConfig]) - fields are considered set if their environment variable is present within environment.
+// Returns [ValidationErrors] listing every invalid field.
+// Returns an error if cfg is not a struct (or a pointer to one) or if any field's rules are invalid.
+func validateConfig(cfg any, environment map[string]string) error {
+	value := reflect.ValueOf(cfg)
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("config must be a struct")
+	}
+	validationErrors := ValidationErrors{}
+	for _, field := range getValidationFields(value, "", "") {
+		validationError, err := field.validate(environment)
+		if err != nil {
+			return err
+		}
+		if validationError != nil {
+			validationErrors = append(validationErrors, *validationError)
+		}
+	}
+	if len(validationErrors) > 0 {
+		return validationErrors
+	}
+	return nil
+}
+
+// Converts errors from parsing a config struct from the environment (see: [env.Parse]) into [ValidationErrors] so that parse errors (e.g., 'MAX_PLAYERS=abc' or a missing required variable) are reported alongside validation errors.
+// Errors that do not concern a specific variable are reported by their message alone.
+// Returns an error if err is not an [env.AggregateError].
+func getEnvValidationErrors(cfg any, err error, environment map[string]string) (ValidationErrors, error) {
+	aggregateErr := env.AggregateError{}
+	if !errors.As(err, &aggregateErr) {
+		return nil, err
+	}
+	value := reflect.ValueOf(cfg)
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+	fields := getValidationFields(value, "", "")
+	getValidationError := func(match func(field validationField) bool, variable string, rule string, message string) ValidationError {
+		validationError := ValidationError{Message: message, Rule: rule, Value: environment[variable], Variable: variable}
+		for _, field := range fields {
+			if !match(field) || field.variable == "" {
+				continue
+			}
+			validationError.Field = field.path
+			validationError.Value = environment[field.variable]
+			validationError.Variable = field.variable
+			if isSecretField(field.field) {
+				validationError.Value = secretRedacted
+			}
+			break
+		}
+		return validationError
+	}
+	matchVariable := func(variable string) func(field validationField) bool {
+		return func(field validationField) bool { return field.variable == variable }
+	}
+
+	validationErrors := ValidationErrors{}
+	for _, item := range aggregateErr.Errors {
+		parseErr := env.ParseError{}
+		notSetErr := env.VarIsNotSetError{}
+		emptyErr := env.EmptyVarError{}
+		fileErr := env.LoadFileContentError{}
+		var validationError ValidationError
+		switch {
+		case errors.As(item, &parseErr):
+			validationError = getValidationError(func(field validationField) bool { return field.field.Name == parseErr.Name }, "", "type", fmt.Sprintf("must be a valid %s", parseErr.Type))
+			if validationError.Variable == "" {
+				validationError.Field = parseErr.Name
+				validationError.Message = parseErr.Err.Error()
+			}
+		case errors.As(item, &notSetErr):
+			validationError = getValidationError(matchVariable(notSetErr.Key), notSetErr.Key, "required", "is required")
+		case errors.As(item, &emptyErr):
+			validationError = getValidationError(matchVariable(emptyErr.Key), emptyErr.Key, "notEmpty", "must not be empty")
+		case errors.As(item, &fileErr):
+			validationError = getValidationError(matchVariable(fileErr.Key), fileErr.Key, "file", fmt.Sprintf("file %s unreadable: %s", fileErr.Filename, fileErr.Err))
+		default:
+			validationError = ValidationError{Message: item.Error(), Rule: "env"}
+		}
+		validationErrors = append(validationErrors, validationError)
+	}
+	return validationErrors, nil
+}
+
+// Parses a config struct from the environment and validates it (see: [ValidateConfig]).
+// Unset variables are read from files where available (see: [getSecretEnvironment]) - the values of secret fields are added to the secrets store.
+// Returns [ValidationErrors] listing every unparseable or invalid field.
+// Returns an error if the config cannot be parsed or its validation rules are invalid.
+func parseAndValidateConfig(cfg any, store *secrets, secretsDir string) error {
+	environment, loaded, err := getSecretEnvironment(cfg, secretsDir)
+	if err != nil {
+		return err
+	}
+	store.add(loaded...)
+	validationErrors := ValidationErrors{}
+	err = env.ParseWithOptions(cfg, env.Options{Environment: environment})
+	store.add(getSecretValues(cfg)...)
+	if err != nil {
+		validationErrors, err = getEnvValidationErrors(cfg, err, environment)
+		if err != nil {
+			return err
+		}
+	}
+	err = validateConfig(cfg, environment)
+	fieldErrors := ValidationErrors{}
+	if errors.As(err, &fieldErrors) {
+		for _, fieldError := range fieldErrors {
+			// fields that failed to parse are already reported
+			if !slices.ContainsFunc(validationErrors, func(ve ValidationError) bool { return ve.Field == fieldError.Field }) {
+				validationErrors = append(validationErrors, fieldError)
+			}
+		}
+	} else if err != nil {
+		return err
+	}
+	if len(validationErrors) > 0 {
+		return validationErrors
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package helper
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseValidationRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		tag       string
+		expected  []validationRule
+		expectErr bool
+	}{
+		{name: "empty", tag: "", expected: []validationRule{}},
+		{name: "multiple", tag: "required,min=1, max=10", expected: []validationRule{{name: "required"}, {name: "min", param: "1"}, {name: "max", param: "10"}}},
+		{name: "oneof", tag: "oneof=a b c", expected: []validationRule{{name: "oneof", param: "a b c"}}},
+		{name: "regex with commas", tag: "min=1,regex=^[a-z]{1,3}$", expected: []validationRule{{name: "min", param: "1"}, {name: "regex", param: "^[a-z]{1,3}$"}}},
+		{name: "required_if", tag: "required_if=Mode server", expected: []validationRule{{name: "required_if", param: "Mode server"}}},
+		{name: "rejects unknown rule", tag: "required,between=1", expectErr: true},
+		{name: "rejects missing parameter", tag: "min", expectErr: true},
+		{name: "rejects empty parameter", tag: "max=", expectErr: true},
+		{name: "rejects required parameter", tag: "required=true", expectErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules, err := parseValidationRules(test.tag)
+			if test.expectErr {
+				if err == nil {
+					t.Fatalf("expected error (parsed %+v)", rules)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rules, test.expected) {
+				t.Fatalf("parsed %+v (expected %+v)", rules, test.expected)
+			}
+		})
+	}
+}
+
+func TestValidateConfigExplicitZero(t *testing.T) {
+	type config struct {
+		Name string `env:"TEST_NAME" validate:"min=3"`
+		Port int    `env:"TEST_PORT" validate:"min=1"`
+	}
+
+	err := ValidateConfig(&config{})
+	if err != nil {
+		t.Fatalf("unset fields validated: %v", err)
+	}
+
+	t.Setenv("TEST_PORT", "0")
+	err = ValidateConfig(&config{})
+	validationErrors := ValidationErrors{}
+	if !errors.As(err, &validationErrors) || len(validationErrors) != 1 || validationErrors[0].Variable != "TEST_PORT" || validationErrors[0].Rule != "min" {
+		t.Fatalf("unexpected error %v (expected TEST_PORT to fail min)", err)
+	}
+}
+
+func TestParseAndValidateConfigAggregates(t *testing.T) {
+	type config struct {
+		Password string `env:"TEST_PASSWORD,required" secret:"true"`
+		Players  int    `env:"TEST_PLAYERS" validate:"max=64"`
+		Port     int    `env:"TEST_PORT"`
+		Token    string `env:"TEST_TOKEN,notEmpty"`
+	}
+	t.Setenv("TEST_PLAYERS", "100")
+	t.Setenv("TEST_PORT", "abc")
+	t.Setenv("TEST_TOKEN", "")
+
+	err := parseAndValidateConfig(&config{}, newSecrets(), "")
+	validationErrors := ValidationErrors{}
+	if !errors.As(err, &validationErrors) {
+		t.Fatalf("unexpected error %v (expected validation errors)", err)
+	}
+	rules := map[string]string{}
+	for _, validationError := range validationErrors {
+		rules[validationError.Variable] = validationError.Rule
+	}
+	expected := map[string]string{"TEST_PASSWORD": "required", "TEST_PLAYERS": "max", "TEST_PORT": "type", "TEST_TOKEN": "notEmpty"}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Fatalf("reported %v (expected %v)", rules, expected)
+	}
+}